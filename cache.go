@@ -0,0 +1,174 @@
+package dbhub
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// cacheSuffix is the file name suffix of the database files in a cache directory
+	cacheSuffix = ".sqlite"
+
+	// cacheTempPrefix is the file name prefix of databases still being downloaded into a cache directory
+	cacheTempPrefix = "tmp-"
+
+	// staleTempAge is how old an unfinished download in a cache directory needs to be before it's assumed to have been
+	// left behind by a process which crashed, and removed
+	staleTempAge = 24 * time.Hour
+)
+
+// cache is an on-disk store of downloaded database files, named after their SHA256.  As database revisions never
+// change, a cached file can be used for any download of a commit with the same SHA256.
+//
+// Several processes can share a cache directory.  Files are only ever added by renaming a fully downloaded and
+// verified file into place, so readers never see partial files, and two processes adding the same file at once just
+// both write the same data.
+type cache struct {
+	dir     string
+	maxSize int64
+}
+
+// WithCache keeps a copy of downloaded standard databases in dir, so later downloads of the same database revision
+// are read from disk instead of the server.  Download() and DownloadVerified() still ask the server which commit the
+// identifier points to, but skip the download when the database file of that commit is already in the cache.
+//
+// When the files in the cache add up to more than maxSize bytes, the least recently used ones are removed.  A maxSize
+// of zero means there's no limit.  The cache directory is created if needed, and can be shared by several processes.
+func WithCache(dir string, maxSize int64) Option {
+	return func(c *Connection) error {
+		if dir == "" {
+			return fmt.Errorf("no cache directory provided")
+		}
+		if maxSize < 0 {
+			return fmt.Errorf("the maximum cache size can't be negative")
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		c.cache = &cache{dir: dir, maxSize: maxSize}
+		return nil
+	}
+}
+
+// path returns the path of the cached copy of a database file
+func (ca *cache) path(sha string) (string, error) {
+	// The SHA256 comes from the server, so make sure it can't point somewhere outside the cache
+	if b, err := hex.DecodeString(sha); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("'%s' isn't a valid SHA256", sha)
+	}
+	return filepath.Join(ca.dir, strings.ToLower(sha)+cacheSuffix), nil
+}
+
+// open returns the cached copy of a database file, or nil if it isn't in the cache
+func (ca *cache) open(entry DBTreeEntry) (*os.File, error) {
+	path, err := ca.path(entry.Sha256)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Files of the wrong size can only have been damaged after being cached, so throw them away
+	info, err := f.Stat()
+	if err != nil || info.Size() != entry.Size {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	// The modification time of each file is used to track when it was last used.  If another process removes the file
+	// in the meantime that's fine, as it's already open.
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return f, nil
+}
+
+// add stores a database file in the cache, using fill to write its contents, then returns the cached copy
+func (ca *cache) add(entry DBTreeEntry, fill func(f *os.File) error) (*os.File, error) {
+	path, err := ca.path(entry.Sha256)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(ca.dir, cacheTempPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	err = fill(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	ca.evict(path)
+	return f, nil
+}
+
+// evict removes the least recently used files from the cache until it's back under its maximum size.  The file at
+// keep is never removed, even if it's bigger than the maximum size by itself.  Errors are ignored, as another process
+// may be evicting files at the same time.
+func (ca *cache) evict(keep string) {
+	entries, err := os.ReadDir(ca.dir)
+	if err != nil {
+		return
+	}
+	type cachedFile struct {
+		path    string
+		size    int64
+		lastUse time.Time
+	}
+	var files []cachedFile
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(ca.dir, e.Name())
+		switch {
+		case strings.HasPrefix(e.Name(), cacheTempPrefix):
+			if time.Since(info.ModTime()) > staleTempAge {
+				os.Remove(path)
+			}
+		case strings.HasSuffix(e.Name(), cacheSuffix):
+			files = append(files, cachedFile{path: path, size: info.Size(), lastUse: info.ModTime()})
+			total += info.Size()
+		}
+	}
+	if ca.maxSize == 0 || total <= ca.maxSize {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].lastUse.Before(files[j].lastUse) })
+	for _, f := range files {
+		if total <= ca.maxSize {
+			return
+		}
+		if f.path == keep {
+			continue
+		}
+		if os.Remove(f.path) == nil {
+			total -= f.size
+		}
+	}
+}
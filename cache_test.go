@@ -0,0 +1,114 @@
+package dbhub_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// download fetches a whole database
+func download(t *testing.T, conn dbhub.Connection, ident dbhub.Identifier) []byte {
+	t.Helper()
+	body, err := conn.Download(dbhubtest.DefaultUser, "example.db", ident)
+	require.NoError(t, err)
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	return data
+}
+
+// cachedFiles returns the names of the files in a cache directory
+func cachedFiles(t *testing.T, dir string) (names []string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return
+}
+
+// TestCache verifies downloaded databases are cached, and reused by connections sharing the cache directory
+func TestCache(t *testing.T) {
+	srv, _, dbBytes, commit1, _ := newVerifyServer(t, nil)
+	require.NoError(t, srv.AddRelease(dbhubtest.DefaultUser, "example.db", "v1", commit1, ""))
+	dir := filepath.Join(t.TempDir(), "cache")
+	conn, err := srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithCache(dir, 0))
+	require.NoError(t, err)
+
+	assert.Equal(t, dbBytes, download(t, conn, dbhub.Identifier{Release: "v1"}))
+	assert.Equal(t, dbBytes, download(t, conn, dbhub.Identifier{Release: "v1"}))
+	assert.Equal(t, 1, srv.Calls("/v1/download"))
+	assert.Len(t, cachedFiles(t, dir), 1)
+
+	// Another connection (or process) using the same directory shares the cache
+	other, err := srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithCache(dir, 0))
+	require.NoError(t, err)
+	db, commitID, err := other.DownloadVerified(context.Background(), dbhubtest.DefaultUser, "example.db",
+		dbhub.Identifier{Tag: "first"})
+	require.NoError(t, err)
+	assert.Equal(t, commit1, commitID)
+	data, err := io.ReadAll(db)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	assert.Equal(t, dbBytes, data)
+	assert.Equal(t, 1, srv.Calls("/v1/download"))
+
+	// Cached files which have been damaged are downloaded again
+	require.NoError(t, os.Truncate(filepath.Join(dir, cachedFiles(t, dir)[0]), 10))
+	assert.Equal(t, dbBytes, download(t, conn, dbhub.Identifier{Release: "v1"}))
+	assert.Equal(t, 2, srv.Calls("/v1/download"))
+
+	// Live databases aren't cached
+	require.NoError(t, conn.UploadLive("live.db", &dbBytes))
+	body, err := conn.Download(dbhubtest.DefaultUser, "live.db", dbhub.Identifier{})
+	require.NoError(t, err)
+	data, err = io.ReadAll(body)
+	require.NoError(t, err)
+	body.Close()
+	assert.Equal(t, dbBytes, data)
+	assert.Len(t, cachedFiles(t, dir), 1)
+
+	// Missing databases are still reported as missing
+	_, err = conn.Download(dbhubtest.DefaultUser, "missing.db", dbhub.Identifier{})
+	assert.ErrorIs(t, err, dbhub.ErrNotFound)
+}
+
+// TestCacheEviction verifies the least recently used databases are removed when the cache gets too big
+func TestCacheEviction(t *testing.T) {
+	srv, _, dbBytes, commit1, commit2 := newVerifyServer(t, nil)
+	bigger := append(append([]byte{}, dbBytes...), make([]byte, 8192)...)
+	commit3, err := srv.AddDatabase(dbhubtest.DefaultUser, "example.db", bigger,
+		dbhub.UploadInformation{Ident: dbhub.Identifier{CommitID: commit2}})
+	require.NoError(t, err)
+
+	// The cache only has room for two of the three database revisions
+	size := int64(len(dbBytes))
+	dir := t.TempDir()
+	conn, err := srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithCache(dir, 3*size+12288-1))
+	require.NoError(t, err)
+
+	download(t, conn, dbhub.Identifier{CommitID: commit1})
+	download(t, conn, dbhub.Identifier{CommitID: commit2})
+	download(t, conn, dbhub.Identifier{CommitID: commit1})
+	assert.Equal(t, 2, srv.Calls("/v1/download"))
+
+	// Adding the third revision removes the second, as the first was used more recently
+	download(t, conn, dbhub.Identifier{CommitID: commit3})
+	assert.Equal(t, 3, srv.Calls("/v1/download"))
+	assert.Len(t, cachedFiles(t, dir), 2)
+	download(t, conn, dbhub.Identifier{CommitID: commit1})
+	assert.Equal(t, 3, srv.Calls("/v1/download"))
+	download(t, conn, dbhub.Identifier{CommitID: commit2})
+	assert.Equal(t, 4, srv.Calls("/v1/download"))
+
+	_, err = srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithCache(dir, -1))
+	assert.Error(t, err)
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+// cmdLs lists the databases in the user's account
+func cmdLs(e *env, args []string) error {
+	fs := e.flags()
+	live := fs.Bool("live", false, "list Live databases instead of standard ones")
+	if _, err := e.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	conn, err := e.conn()
+	if err != nil {
+		return err
+	}
+	var dbs []string
+	if *live {
+		dbs, err = conn.DatabasesLiveContext(e.ctx)
+	} else {
+		dbs, err = conn.DatabasesContext(e.ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return e.out.list("name", dbs)
+}
+
+// refArgs parses the flags of a command taking a database reference followed by count-1 other arguments
+func (e *env) refArgs(args []string, count int) (conn dbhub.Connection, ref dbhub.Ref, rest []string, err error) {
+	var pos []string
+	if pos, err = e.parse(e.flags(), args, count, count); err != nil {
+		return
+	}
+	if ref, err = dbhub.ParseRef(pos[0]); err != nil {
+		return
+	}
+	conn, err = e.conn()
+	rest = pos[1:]
+	return
+}
+
+// cmdTables lists the tables in a database
+func cmdTables(e *env, args []string) error {
+	conn, ref, _, err := e.refArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	tables, err := conn.TablesContext(e.ctx, ref.Owner, ref.Name, ref.Ident)
+	if err != nil {
+		return err
+	}
+	return e.out.list("table", tables)
+}
+
+// cmdViews lists the views in a database
+func cmdViews(e *env, args []string) error {
+	conn, ref, _, err := e.refArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	views, err := conn.ViewsContext(e.ctx, ref.Owner, ref.Name, ref.Ident)
+	if err != nil {
+		return err
+	}
+	return e.out.list("view", views)
+}
+
+// cmdIndexes lists the indexes in a database
+func cmdIndexes(e *env, args []string) error {
+	conn, ref, _, err := e.refArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	indexes, err := conn.IndexesContext(e.ctx, ref.Owner, ref.Name, ref.Ident)
+	if err != nil {
+		return err
+	}
+	return e.out.indexes(indexes)
+}
+
+// indexes writes a list of indexes
+func (o output) indexes(indexes []dbhub.APIJSONIndex) error {
+	rows := make([][]interface{}, len(indexes))
+	for i, idx := range indexes {
+		var cols []string
+		for _, c := range idx.Columns {
+			cols = append(cols, c.Name)
+		}
+		rows[i] = []interface{}{idx.Name, idx.Table, strings.Join(cols, ", ")}
+	}
+	return o.table([]string{"index", "table", "columns"}, rows)
+}
+
+// cmdColumns lists the columns in a table or view
+func cmdColumns(e *env, args []string) error {
+	conn, ref, rest, err := e.refArgs(args, 2)
+	if err != nil {
+		return err
+	}
+	columns, err := conn.ColumnsContext(e.ctx, ref.Owner, ref.Name, ref.Ident, rest[0])
+	if err != nil {
+		return err
+	}
+	return e.out.columns(columns)
+}
+
+// columns writes a list of the columns in a table or view
+func (o output) columns(columns []dbhub.APIJSONColumn) error {
+	rows := make([][]interface{}, len(columns))
+	for i, c := range columns {
+		rows[i] = []interface{}{c.Name, c.DataType, c.NotNull, c.DfltValue, c.Pk}
+	}
+	return o.table([]string{"name", "type", "not_null", "default", "primary_key"}, rows)
+}
+
+// sqlArg returns the SQL given on the command line, reading it from stdin when it's "-"
+func (e *env) sqlArg(arg string) (string, error) {
+	if arg != "-" {
+		return arg, nil
+	}
+	data, err := io.ReadAll(e.stdin)
+	return string(data), err
+}
+
+// cmdQuery runs a read only query
+func cmdQuery(e *env, args []string) error {
+	conn, ref, rest, err := e.refArgs(args, 2)
+	if err != nil {
+		return err
+	}
+	sql, err := e.sqlArg(rest[0])
+	if err != nil {
+		return err
+	}
+	res, err := conn.QueryTypedContext(e.ctx, ref.Owner, ref.Name, ref.Ident, sql)
+	if err != nil {
+		return err
+	}
+	return e.out.results(res)
+}
+
+// results writes the results of a query
+func (o output) results(res dbhub.TypedResults) error {
+	columns := make([]string, len(res.Columns))
+	for i, c := range res.Columns {
+		columns[i] = c.Name
+	}
+	return o.table(columns, res.Rows)
+}
+
+// cmdExec runs a statement which changes a Live database
+func cmdExec(e *env, args []string) error {
+	conn, ref, rest, err := e.refArgs(args, 2)
+	if err != nil {
+		return err
+	}
+	sql, err := e.sqlArg(rest[0])
+	if err != nil {
+		return err
+	}
+	n, err := conn.ExecuteContext(e.ctx, ref.Owner, ref.Name, sql)
+	if err != nil {
+		return err
+	}
+	return e.out.rowsChanged(n)
+}
+
+// rowsChanged writes the number of rows changed by a statement
+func (o output) rowsChanged(n int) error {
+	return o.table([]string{"rows_changed"}, [][]interface{}{{int64(n)}})
+}
+
+// cmdDownload downloads a database into a file
+func cmdDownload(e *env, args []string) error {
+	fs := e.flags()
+	path := fs.String("o", "", "the file to save the database as, or - for stdout (default the database name)")
+	live := fs.Bool("live", false, "download a Live database, which doesn't have commits to check it against")
+	pos, err := e.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	ref, err := dbhub.ParseRef(pos[0])
+	if err != nil {
+		return err
+	}
+	conn, err := e.conn()
+	if err != nil {
+		return err
+	}
+	if *path == "" {
+		*path = filepath.Base(ref.Name)
+	}
+
+	// Live databases and downloads to stdout can't be checked before they're handed over, so are sent as is
+	if *live || *path == "-" {
+		db, err := conn.DownloadContext(e.ctx, ref.Owner, ref.Name, ref.Ident)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if *path == "-" {
+			_, err = io.Copy(e.stdout, db)
+			return err
+		}
+		return writeFile(*path, db)
+	}
+	commitID, err := conn.DownloadToFile(e.ctx, ref.Owner, ref.Name, ref.Ident, *path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "Downloaded %s (commit %s) to %s\n", ref, commitID, *path)
+	return nil
+}
+
+// writeFile saves the contents of a reader to a file
+func writeFile(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// cmdUpload uploads a database file
+func cmdUpload(e *env, args []string) error {
+	fs := e.flags()
+	name := fs.String("name", "", "the name of the database on DBHub.io (default the file name)")
+	branch := fs.String("branch", "", "the branch to add the commit to (default the default branch)")
+	parent := fs.String("commit", "", "the commit the upload follows on from, to avoid overwriting other changes")
+	message := fs.String("message", "", "the commit message")
+	licence := fs.String("licence", "", "the licence of the database")
+	public := fs.Bool("public", false, "make the database public")
+	force := fs.Bool("force", false, "overwrite newer commits on the branch")
+	live := fs.Bool("live", false, "upload as a Live database")
+	pos, err := e.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *name == "" {
+		*name = filepath.Base(pos[0])
+	}
+	conn, err := e.conn()
+	if err != nil {
+		return err
+	}
+	var shaSum string
+	if *live {
+		shaSum, err = conn.UploadLiveFile(e.ctx, *name, pos[0])
+	} else {
+		info := dbhub.UploadInformation{
+			Ident:     dbhub.Identifier{Branch: *branch, CommitID: *parent},
+			CommitMsg: *message,
+			Licence:   *licence,
+			Force:     *force,
+		}
+		if *public {
+			info.Public = "true"
+		}
+		shaSum, err = conn.UploadFile(e.ctx, *name, info, pos[0])
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "Uploaded %s as %s (SHA256 %s)\n", pos[0], *name, shaSum)
+	return nil
+}
+
+// cmdDiff shows the differences between two databases, or versions of a database
+func cmdDiff(e *env, args []string) error {
+	fs := e.flags()
+	merge := fs.String("merge", "preserve", "the SQL to generate: preserve (keeps primary keys), new (generates "+
+		"new primary keys), or none (only lists the changes)")
+	pos, err := e.parse(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	a, err := dbhub.ParseRef(pos[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := versionRef(a, pos[1])
+	if err != nil {
+		return err
+	}
+	strategies := map[string]dbhub.MergeStrategy{"none": dbhub.NoMerge, "preserve": dbhub.PreservePkMerge,
+		"new": dbhub.NewPkMerge}
+	strategy, ok := strategies[*merge]
+	if !ok {
+		return fmt.Errorf("unknown merge strategy '%s', it should be none, preserve, or new", *merge)
+	}
+	conn, err := e.conn()
+	if err != nil {
+		return err
+	}
+	diffs, err := conn.DiffContext(e.ctx, a.Owner, a.Name, a.Ident, b.Owner, b.Name, b.Ident, strategy)
+	if err != nil {
+		return err
+	}
+
+	// The SQL is the most useful thing to show, except for JSON output where everything is included
+	var rows [][]interface{}
+	for _, d := range diffs.Diff {
+		if d.Schema != nil {
+			rows = append(rows, []interface{}{d.ObjectType, d.ObjectName, string(d.Schema.ActionType), d.Schema.Sql})
+		}
+		for _, data := range d.Data {
+			rows = append(rows, []interface{}{d.ObjectType, d.ObjectName, string(data.ActionType), data.Sql})
+		}
+	}
+	if e.out.format == "table" && strategy == dbhub.NoMerge {
+		// There's no SQL to show, so list the changes instead
+		for _, r := range rows {
+			fmt.Fprintf(e.stdout, "%s %s %s\n", r[2], r[0], r[1])
+		}
+		return nil
+	}
+	switch e.out.format {
+	case "json":
+		return jsonEncoder(e.stdout).Encode(diffs)
+	case "csv":
+		return e.out.table([]string{"object_type", "object_name", "action", "sql"}, rows)
+	}
+	for _, r := range rows {
+		if r[3] != "" {
+			fmt.Fprintln(e.stdout, r[3])
+		}
+	}
+	return nil
+}
+
+// versionRef parses a database reference which can also be just a version, eg "@branch" or "#commit", meaning that
+// version of the base database
+func versionRef(base dbhub.Ref, s string) (dbhub.Ref, error) {
+	if strings.HasPrefix(s, "@") || strings.HasPrefix(s, "#") {
+		s = dbhub.Ref{Owner: base.Owner, Name: base.Name}.String() + s
+	}
+	return dbhub.ParseRef(s)
+}
+
+// cmdLog shows the commit history of a database
+func cmdLog(e *env, args []string) error {
+	fs := e.flags()
+	all := fs.Bool("all", false, "show the commits on all branches")
+	var opts dbhub.LogOptions
+	fs.StringVar(&opts.Author, "author", "", "only show commits by authors whose name or email contains this")
+	fs.StringVar(&opts.Message, "grep", "", "only show commits whose message contains this")
+	since := fs.String("since", "", "only show commits made on or after this date (YYYY-MM-DD or RFC 3339)")
+	until := fs.String("until", "", "only show commits made before this date (YYYY-MM-DD or RFC 3339)")
+	exclude := fs.String("not", "", "leave out the commits reachable from this version, eg @tag:v1 or #commit")
+	limit := fs.Int("n", 0, "show at most this many commits")
+	pos, err := e.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	ref, err := dbhub.ParseRef(pos[0])
+	if err != nil {
+		return err
+	}
+	if opts.Since, err = parseDate(*since); err != nil {
+		return err
+	}
+	if opts.Until, err = parseDate(*until); err != nil {
+		return err
+	}
+	conn, err := e.conn()
+	if err != nil {
+		return err
+	}
+	graph, err := conn.CommitGraphContext(e.ctx, ref.Owner, ref.Name)
+	if err != nil {
+		return err
+	}
+	if !*all {
+		head, err := graph.Resolve(ref.Ident)
+		if err != nil {
+			return err
+		}
+		opts.Heads = []string{head}
+	}
+	if *exclude != "" {
+		notRef, err := versionRef(ref, *exclude)
+		if err != nil {
+			return err
+		}
+		id, err := graph.Resolve(notRef.Ident)
+		if err != nil {
+			return err
+		}
+		opts.Exclude = []string{id}
+	}
+	commits, err := graph.Log(opts)
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(commits) > *limit {
+		commits = commits[:*limit]
+	}
+	rows := make([][]interface{}, len(commits))
+	for i, c := range commits {
+		msg, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+		rows[i] = []interface{}{c.ID, c.Timestamp, c.AuthorName, c.AuthorEmail, msg}
+	}
+	return e.out.table([]string{"commit", "date", "author", "email", "message"}, rows)
+}
+
+// parseDate parses a date given on the command line
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date '%s', it should be YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, nil
+}
+
+// cmdBranches lists the branches of a database
+func cmdBranches(e *env, args []string) error {
+	conn, ref, _, err := e.refArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	branches, defaultBranch, err := conn.BranchesContext(e.ctx, ref.Owner, ref.Name)
+	if err != nil {
+		return err
+	}
+	var rows [][]interface{}
+	for _, name := range sortedNames(branches) {
+		b := branches[name]
+		rows = append(rows, []interface{}{name, b.Commit, int64(b.CommitCount), name == defaultBranch, b.Description})
+	}
+	return e.out.table([]string{"branch", "commit", "commits", "default", "description"}, rows)
+}
+
+// cmdTags lists the tags of a database
+func cmdTags(e *env, args []string) error {
+	conn, ref, _, err := e.refArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	tags, err := conn.TagsContext(e.ctx, ref.Owner, ref.Name)
+	if err != nil {
+		return err
+	}
+	var rows [][]interface{}
+	for _, name := range sortedNames(tags) {
+		t := tags[name]
+		rows = append(rows, []interface{}{name, t.Commit, t.Date, t.TaggerName, t.Description})
+	}
+	return e.out.table([]string{"tag", "commit", "date", "tagger", "description"}, rows)
+}
+
+// cmdReleases lists the releases of a database
+func cmdReleases(e *env, args []string) error {
+	conn, ref, _, err := e.refArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	releases, err := conn.ReleasesContext(e.ctx, ref.Owner, ref.Name)
+	if err != nil {
+		return err
+	}
+	var rows [][]interface{}
+	for _, name := range sortedNames(releases) {
+		r := releases[name]
+		rows = append(rows, []interface{}{name, r.Commit, r.Date, r.ReleaserName, r.Size, r.Description})
+	}
+	return e.out.table([]string{"release", "commit", "date", "releaser", "size", "description"}, rows)
+}
+
+// cmdRm deletes a database
+func cmdRm(e *env, args []string) error {
+	fs := e.flags()
+	yes := fs.Bool("y", false, "don't ask for confirmation")
+	pos, err := e.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	name := pos[0]
+	if !*yes {
+		if !isTerminal(e.stdin) {
+			return fmt.Errorf("not deleting '%s' without confirmation, use -y to delete it anyway", name)
+		}
+		fmt.Fprintf(e.stderr, "Delete '%s'? This can't be undone. [y/N] ", name)
+		answer, _ := bufio.NewReader(e.stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return fmt.Errorf("not deleted")
+		}
+	}
+	conn, err := e.conn()
+	if err != nil {
+		return err
+	}
+	if err = conn.DeleteContext(e.ctx, name); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "Deleted %s\n", name)
+	return nil
+}
+
+// isTerminal returns true if r is an interactive terminal
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// cmdWeb shows the web page URL of a database
+func cmdWeb(e *env, args []string) error {
+	conn, ref, _, err := e.refArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	page, err := conn.WebpageContext(e.ctx, ref.Owner, ref.Name)
+	if err != nil {
+		return err
+	}
+
+	// The server only knows about the database, so add the version to the URL
+	webURL := page.WebPage
+	if _, query, ok := strings.Cut(ref.WebURL(""), "?"); ok {
+		webURL += "?" + query
+	}
+	return e.out.list("url", []string{webURL})
+}
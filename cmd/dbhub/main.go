@@ -0,0 +1,272 @@
+// Command dbhub works with databases stored on DBHub.io from the command line.
+//
+// Usage:
+//
+//	dbhub [-profile NAME] [-key KEY] [-server URL] <command> [flags] [arguments]
+//
+// Databases are named using the reference syntax understood by dbhub.ParseRef():
+//
+//	owner/database.sqlite                  the head of the default branch
+//	owner/database.sqlite@branch           the head of a branch
+//	owner/database.sqlite#commit           a commit
+//	owner/database.sqlite@tag:name         a tag
+//	owner/database.sqlite@release:name     a release
+//
+// or by the URL of the database's web page.
+//
+// The connection settings are taken from the -key and -server flags, then a profile in the config file
+// (~/.config/dbhub/config).  The -profile flag or DBHUB_PROFILE chooses the profile.  When neither is set, the
+// DBHUB_API_KEY, DBHUB_SERVER, and DBHUB_VERIFY_CERT environment variables override the default profile.  See
+// dbhub.LoadProfile() for the config file format:
+//
+//	key = YOUR_API_KEY_HERE
+//
+//	[work]
+//	server = https://dbhub.example.com:5550
+//	key_command = pass show dbhub/work
+//	ca_file = /etc/ssl/certs/example-ca.pem
+//
+// Commands which list things take -format table (the default), -format json, or -format csv.  Run "dbhub help" for
+// the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+// command is one of the dbhub sub commands
+type command struct {
+	name  string
+	args  string // The arguments taken by the command, shown in the usage message
+	short string // A one line description of the command
+	run   func(e *env, args []string) error
+}
+
+// commands lists the sub commands, in the order they're shown in the usage message
+var commands []command
+
+func init() {
+	// This is set up here rather than as part of the declaration, as the help command refers back to the list
+	commands = []command{
+		{"ls", "[-live]", "List the databases in your account", cmdLs},
+		{"tables", "REF", "List the tables in a database", cmdTables},
+		{"views", "REF", "List the views in a database", cmdViews},
+		{"indexes", "REF", "List the indexes in a database", cmdIndexes},
+		{"columns", "REF TABLE", "List the columns in a table or view", cmdColumns},
+		{"query", "REF SQL", "Run a read only query (SQL can be - to read it from stdin)", cmdQuery},
+		{"exec", "REF SQL", "Run an INSERT, UPDATE, DELETE, or other statement on a Live database", cmdExec},
+		{"download", "[-o FILE] [-live] REF", "Download a database, checking it against its commit", cmdDownload},
+		{"upload", "[-name NAME] [-branch BRANCH] [-message MSG] [-live] FILE", "Upload a database", cmdUpload},
+		{"shell", "REF", "Run SQL statements interactively, with sqlite3 style dot commands", cmdShell},
+		{"diff", "REF REF", "Show the SQL needed to turn one database version into another", cmdDiff},
+		{"log", "[-all] [-author A] [-grep TEXT] [-since DATE] [-until DATE] [-n N] REF", "Show the commit history",
+			cmdLog},
+		{"branches", "REF", "List the branches of a database", cmdBranches},
+		{"tags", "REF", "List the tags of a database", cmdTags},
+		{"releases", "REF", "List the releases of a database", cmdReleases},
+		{"rm", "[-y] NAME", "Delete one of your databases", cmdRm},
+		{"web", "REF", "Show the web page URL of a database", cmdWeb},
+		{"help", "", "Show this help", cmdHelp},
+	}
+}
+
+// errUsage is returned by commands given the wrong arguments, after the usage message has been shown
+var errUsage = errors.New("usage")
+
+func main() {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	code := run(context.Background(), interrupts, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	signal.Stop(interrupts)
+	os.Exit(code)
+}
+
+// run runs the command line, returning the exit code.  Each interrupt (ie Ctrl-C) received from interrupts cancels the
+// command, apart from in the shell where it only cancels the statement being run.
+func run(ctx context.Context, interrupts <-chan os.Signal, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e := &env{ctx: ctx, stdin: stdin, stdout: stdout, stderr: stderr, out: output{w: stdout}, interrupt: cancel}
+	go e.handleInterrupts(interrupts)
+	fs := flag.NewFlagSet("dbhub", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&e.key, "key", "", "the DBHub.io API key to use")
+	fs.StringVar(&e.server, "server", "", "the address of the DBHub.io API server")
+	fs.StringVar(&e.profile, "profile", "", "the profile in the config file to take the connection settings from")
+	fs.StringVar(&e.out.format, "format", "table", "the output format: table, json, or csv")
+	fs.Usage = func() { usage(stderr) }
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	name := fs.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		e.cmd = cmd
+		err := cmd.run(e, fs.Args()[1:])
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		}
+		fmt.Fprintf(stderr, "dbhub %s: %s\n", name, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "dbhub: unknown command '%s'\n", name)
+	usage(stderr)
+	return 2
+}
+
+// usage shows the list of commands
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: dbhub [-profile NAME] [-key KEY] [-server URL] [-format table|json|csv] <command> "+
+		"[arguments]\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(w, "\nDatabases (REF) are written as owner/database, followed by @branch, #commit, @tag:name, or "+
+		"@release:name\nto choose a version.  Run \"dbhub <command> -h\" for the flags of a command.\n")
+}
+
+// cmdHelp shows the usage message
+func cmdHelp(e *env, args []string) error {
+	usage(e.stdout)
+	return nil
+}
+
+// env holds the settings and input/output streams used by the commands
+type env struct {
+	ctx    context.Context
+	cmd    command
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	out    output
+
+	// profile, key, and server are the values of the -profile, -key, and -server flags
+	profile string
+	key     string
+	server  string
+
+	// interrupt is called when an interrupt is received.  It's nil while interrupts are ignored.
+	mu        sync.Mutex
+	interrupt func()
+}
+
+// handleInterrupts calls the current interrupt function for each interrupt received, until the command finishes
+func (e *env) handleInterrupts(interrupts <-chan os.Signal) {
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-interrupts:
+			e.mu.Lock()
+			interrupt := e.interrupt
+			e.mu.Unlock()
+			if interrupt != nil {
+				interrupt()
+			}
+		}
+	}
+}
+
+// onInterrupt changes the function called when an interrupt is received.  nil ignores interrupts.
+func (e *env) onInterrupt(f func()) {
+	e.mu.Lock()
+	e.interrupt = f
+	e.mu.Unlock()
+}
+
+// flags returns a flag set for the current command, which also accepts the -format flag
+func (e *env) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("dbhub "+e.cmd.name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.StringVar(&e.out.format, "format", e.out.format, "the output format: table, json, or csv")
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: dbhub %s %s\n\n%s\n", e.cmd.name, e.cmd.args, e.cmd.short)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of the current command, which can be mixed in with its arguments.  The arguments are
+// returned, and checked there are between min and max of them (a max of -1 means no limit).
+func (e *env) parse(fs *flag.FlagSet, args []string, min, max int) (pos []string, err error) {
+	for {
+		if err = fs.Parse(args); err != nil {
+			if err != flag.ErrHelp {
+				err = errUsage
+			}
+			return
+		}
+
+		// Everything after "--" is an argument, even if it looks like a flag
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			pos = append(pos, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		pos = append(pos, rest[0])
+		args = rest[1:]
+	}
+	if len(pos) < min || (max >= 0 && len(pos) > max) {
+		fs.Usage()
+		err = errUsage
+		return
+	}
+	if err = e.out.check(); err != nil {
+		return
+	}
+	return
+}
+
+// conn returns a connection to the server, using the API key and server from the flags, environment, or config file
+func (e *env) conn() (dbhub.Connection, error) {
+	p, err := dbhub.LoadProfile(e.profile)
+	if err != nil {
+		return dbhub.Connection{}, err
+	}
+	if e.key != "" {
+		p.Key = e.key
+	}
+	if e.server != "" {
+		p.Server = e.server
+	}
+	return dbhub.NewFromProfile(p)
+}
+
+// sortedNames returns the keys of a map in alphabetical order
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
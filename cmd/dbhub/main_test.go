@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDB returns the contents of a new SQLite database, created by running the given SQL statements
+func newDB(t *testing.T, statements ...string) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+	sdb, err := sqlite.Open(path)
+	require.NoError(t, err)
+	for _, s := range statements {
+		require.NoError(t, sdb.Exec(s))
+	}
+	require.NoError(t, sdb.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
+
+// testEnv holds a test server, which the environment variables point the command at
+type testEnv struct {
+	srv     *dbhubtest.Server
+	home    string
+	stdin   string
+	commit1 string
+	commit2 string
+}
+
+// newTestEnv starts a test server holding a standard database with two commits, and a Live database
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	srv := dbhubtest.NewServer()
+	t.Cleanup(srv.Close)
+	te := &testEnv{srv: srv, home: t.TempDir()}
+	t.Setenv("DBHUB_API_KEY", dbhubtest.DefaultAPIKey)
+	t.Setenv("DBHUB_SERVER", srv.URL)
+	t.Setenv("HOME", te.home)
+	for _, name := range []string{"DBHUB_PROFILE", "DBHUB_VERIFY_CERT", "XDG_CONFIG_HOME", "XDG_STATE_HOME"} {
+		t.Setenv(name, "")
+	}
+	var err error
+	te.commit1, err = srv.AddDatabase(dbhubtest.DefaultUser, "test.sqlite", newDB(t,
+		"CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT NOT NULL, age INTEGER)",
+		"INSERT INTO people VALUES (1, 'Alice', 30), (2, 'Bob', NULL)"), dbhub.UploadInformation{CommitMsg: "First"})
+	require.NoError(t, err)
+	te.commit2, err = srv.AddDatabase(dbhubtest.DefaultUser, "test.sqlite", newDB(t,
+		"CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT NOT NULL, age INTEGER)",
+		"INSERT INTO people VALUES (1, 'Alice', 31), (3, 'Carol', 25)",
+		"CREATE INDEX people_name ON people (name)",
+		"CREATE VIEW adults AS SELECT name FROM people WHERE age >= 18"),
+		dbhub.UploadInformation{CommitMsg: "Second", Ident: dbhub.Identifier{CommitID: te.commit1}})
+	require.NoError(t, err)
+	require.NoError(t, srv.AddTag(dbhubtest.DefaultUser, "test.sqlite", "v1", te.commit1, "First tag"))
+	require.NoError(t, srv.AddLiveDatabase(dbhubtest.DefaultUser, "live.sqlite", newDB(t,
+		"CREATE TABLE t (a INTEGER, b TEXT)", "INSERT INTO t VALUES (1, 'one'), (2, 'two')")))
+	return te
+}
+
+// run runs the command with the given arguments, returning its exit code and output
+func (te *testEnv) run(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(context.Background(), nil, args, strings.NewReader(te.stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+// ok runs the command, failing the test if it doesn't succeed
+func (te *testEnv) ok(t *testing.T, args ...string) string {
+	t.Helper()
+	code, stdout, stderr := te.run(args...)
+	require.Equal(t, 0, code, "dbhub %s: %s", strings.Join(args, " "), stderr)
+	return stdout
+}
+
+// TestListCommands verifies the commands which list things, in each of the output formats
+func TestListCommands(t *testing.T) {
+	te := newTestEnv(t)
+	ref := "default/test.sqlite"
+
+	assert.Equal(t, "name\n----\ntest.sqlite\n", te.ok(t, "ls"))
+	assert.Equal(t, "name\nlive.sqlite\n", te.ok(t, "-format", "csv", "ls", "-live"))
+	assert.Equal(t, "table\n-----\npeople\n", te.ok(t, "tables", ref))
+	assert.Equal(t, "table\n-----\npeople\n", te.ok(t, "tables", ref+"@tag:v1"))
+	assert.Equal(t, "view\n----\n", te.ok(t, "views", ref+"#"+te.commit1))
+	assert.Equal(t, "view\nadults\n", te.ok(t, "views", ref, "-format", "csv"))
+	assert.Equal(t, "index,table,columns\npeople_name,people,name\n", te.ok(t, "indexes", "-format=csv", ref))
+	assert.Equal(t, `name,type,not_null,default,primary_key
+id,INTEGER,false,,1
+name,TEXT,true,,0
+age,INTEGER,false,,0
+`, te.ok(t, "columns", "-format", "csv", ref, "people"))
+
+	var branches []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(te.ok(t, "branches", "-format", "json", ref)), &branches))
+	require.Len(t, branches, 1)
+	assert.Equal(t, "main", branches[0]["branch"])
+	assert.Equal(t, te.commit2, branches[0]["commit"])
+	assert.Equal(t, true, branches[0]["default"])
+	assert.Contains(t, te.ok(t, "tags", ref), "v1   "+te.commit1)
+	assert.Equal(t, "release,commit,date,releaser,size,description\n", te.ok(t, "releases", "-format", "csv", ref))
+
+	assert.Equal(t, "url\n---\nhttps://dbhub.test/default/test.sqlite?tag=v1\n", te.ok(t, "web", ref+"@tag:v1"))
+	assert.Equal(t, "url\n---\nhttps://dbhub.test/default/test.sqlite\n",
+		te.ok(t, "web", "https://dbhub.test/default/test.sqlite"))
+}
+
+// TestQueryCommands verifies running queries and statements
+func TestQueryCommands(t *testing.T) {
+	te := newTestEnv(t)
+	ref := "default/test.sqlite"
+
+	assert.Equal(t, "id  name   age\n--  ----   ---\n1   Alice  30\n2   Bob    NULL\n",
+		te.ok(t, "query", ref+"#"+te.commit1, "SELECT * FROM people ORDER BY id"))
+	assert.Equal(t, "id,name,age\n1,Alice,30\n2,Bob,\n",
+		te.ok(t, "query", "-format", "csv", ref+"#"+te.commit1, "SELECT * FROM people ORDER BY id"))
+	assert.JSONEq(t, `[{"id":1,"name":"Alice","age":31},{"id":3,"name":"Carol","age":25}]`,
+		te.ok(t, "-format", "json", "query", ref, "SELECT * FROM people ORDER BY id"))
+
+	// Statements can be read from stdin, and write to Live databases
+	te.stdin = "UPDATE t SET b = 'changed' WHERE a > 0"
+	assert.Equal(t, "rows_changed\n2\n", te.ok(t, "exec", "-format", "csv", "default/live.sqlite", "-"))
+	assert.Equal(t, "b\nchanged\nchanged\n",
+		te.ok(t, "query", "-format", "csv", "default/live.sqlite", "SELECT b FROM t"))
+
+	// Errors from the server are shown
+	code, _, stderr := te.run("query", ref, "SELECT * FROM missing")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "dbhub query: ")
+}
+
+// TestTransferCommands verifies uploading, downloading, and deleting databases
+func TestTransferCommands(t *testing.T) {
+	te := newTestEnv(t)
+	dir := t.TempDir()
+
+	// Download a database, then upload it again under another name
+	path := filepath.Join(dir, "first.sqlite")
+	te.ok(t, "download", "-o", path, "default/test.sqlite@tag:v1")
+	te.ok(t, "upload", "-name", "copy.sqlite", "-message", "Copied", path)
+	assert.Equal(t, "name\ncopy.sqlite\ntest.sqlite\n", te.ok(t, "ls", "-format", "csv"))
+	out := te.ok(t, "log", "-format", "csv", "default/copy.sqlite")
+	assert.Contains(t, out, ",Copied\n")
+
+	// Downloads to stdout, and of Live databases
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), te.ok(t, "download", "-o", "-", "default/copy.sqlite"))
+	livePath := filepath.Join(dir, "live.sqlite")
+	te.ok(t, "download", "-live", "-o", livePath, "default/live.sqlite")
+	assert.FileExists(t, livePath)
+
+	// Deleting needs confirmation
+	code, _, stderr := te.run("rm", "copy.sqlite")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "use -y")
+	te.ok(t, "rm", "-y", "copy.sqlite")
+	assert.Equal(t, "name\ntest.sqlite\n", te.ok(t, "ls", "-format", "csv"))
+}
+
+// TestHistoryCommands verifies the log and diff commands
+func TestHistoryCommands(t *testing.T) {
+	te := newTestEnv(t)
+	ref := "default/test.sqlite"
+
+	out := te.ok(t, "log", "-format", "csv", ref)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], te.commit2+","))
+	assert.True(t, strings.HasPrefix(lines[2], te.commit1+","))
+	assert.Equal(t, 2, strings.Count(te.ok(t, "log", "-format", "csv", "-not", "@tag:v1", ref), "\n"))
+	assert.Equal(t, 2, strings.Count(te.ok(t, "log", "-format", "csv", "-grep", "first", ref), "\n"))
+	assert.Equal(t, 2, strings.Count(te.ok(t, "log", "-format", "csv", "-n", "1", ref), "\n"))
+
+	out = te.ok(t, "diff", ref+"@tag:v1", "@main")
+	assert.Contains(t, out, `UPDATE "people" SET "age"=31 WHERE "id"=1;`)
+	assert.Contains(t, out, `DELETE FROM "people" WHERE "id"=2;`)
+	assert.Contains(t, te.ok(t, "diff", "-merge", "none", ref+"@tag:v1", "@main"), "modify table people\n")
+	out = te.ok(t, "diff", "-format", "json", ref+"#"+te.commit1, ref)
+	var diffs dbhub.Diffs
+	require.NoError(t, json.Unmarshal([]byte(out), &diffs))
+	assert.NotEmpty(t, diffs.Diff)
+}
+
+// TestSettings verifies where the API key and server are taken from, and the handling of bad command lines
+func TestSettings(t *testing.T) {
+	te := newTestEnv(t)
+
+	// The config file is used when nothing is set in the environment
+	cfgDir := filepath.Join(te.home, ".config", "dbhub")
+	require.NoError(t, os.MkdirAll(cfgDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(cfgDir, "config"), []byte("# Test server\nkey = "+
+		dbhubtest.DefaultAPIKey+"\nserver = "+te.srv.URL+"/\n\n[other]\nkey = wrong\nserver = "+te.srv.URL+"\n"),
+		0600))
+	t.Setenv("DBHUB_API_KEY", "")
+	t.Setenv("DBHUB_SERVER", "")
+	te.ok(t, "ls")
+
+	// Profiles are chosen with a flag or the environment
+	code, _, stderr := te.run("-profile", "other", "ls")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "dbhub ls: ")
+	t.Setenv("DBHUB_PROFILE", "other")
+	code, _, _ = te.run("ls")
+	assert.Equal(t, 1, code)
+	te.ok(t, "-profile", "default", "ls")
+	code, _, stderr = te.run("-profile", "missing", "ls")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "there's no profile named 'missing'")
+	t.Setenv("DBHUB_PROFILE", "")
+
+	// The environment overrides the default profile, and flags override both
+	t.Setenv("DBHUB_API_KEY", "wrong")
+	code, _, _ = te.run("ls")
+	assert.Equal(t, 1, code)
+	te.ok(t, "-key", dbhubtest.DefaultAPIKey, "ls")
+
+	// Named profiles aren't mixed with settings from the environment
+	te.ok(t, "-profile", "default", "ls")
+	t.Setenv("DBHUB_API_KEY", dbhubtest.DefaultAPIKey)
+	code, _, _ = te.run("-profile", "other", "ls")
+	assert.Equal(t, 1, code)
+
+	require.NoError(t, os.WriteFile(filepath.Join(cfgDir, "config"), []byte("colour = blue\n"), 0600))
+	code, _, stderr = te.run("ls")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown setting 'colour'")
+
+	// Bad command lines
+	for _, args := range [][]string{{}, {"nope"}, {"tables"}, {"tables", "a/b", "c"}, {"ls", "-nope"}} {
+		code, _, _ = te.run(args...)
+		assert.Equal(t, 2, code, "%v", args)
+	}
+	code, _, stderr = te.run("ls", "-format", "xml")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "unknown output format 'xml'")
+	code, _, stderr = te.run("tables", "not-a-ref")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "should start with owner/database")
+	assert.Contains(t, te.ok(t, "help"), "Commands:")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// output writes tables of results in the chosen format
+type output struct {
+	format string
+	w      io.Writer
+}
+
+// check makes sure the output format is one we know about
+func (o output) check() error {
+	switch o.format {
+	case "table", "json", "csv":
+		return nil
+	}
+	return fmt.Errorf("unknown output format '%s', it should be table, json, or csv", o.format)
+}
+
+// table writes rows of values under the given column names.  JSON output is a list of objects, one per row, keeping
+// the native types of the values.  Table and CSV output turn the values into text, with BLOBs shown as hex literals.
+func (o output) table(columns []string, rows [][]interface{}) error {
+	switch o.format {
+	case "json":
+		list := make([]jsonRow, len(rows))
+		for i, r := range rows {
+			list[i] = jsonRow{columns, r}
+		}
+		return jsonEncoder(o.w).Encode(list)
+	case "csv":
+		w := csv.NewWriter(o.w)
+		w.Write(columns)
+		for _, r := range rows {
+			rec := make([]string, len(r))
+			for i, v := range r {
+				rec[i] = text(v, "")
+			}
+			w.Write(rec)
+		}
+		w.Flush()
+		return w.Error()
+	}
+	w := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	dashes := make([]string, len(columns))
+	for i, c := range columns {
+		dashes[i] = strings.Repeat("-", len(c))
+	}
+	fmt.Fprintln(w, strings.Join(dashes, "\t"))
+	for _, r := range rows {
+		vals := make([]string, len(r))
+		for i, v := range r {
+			// Tabs and newlines would break up the table
+			vals[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(text(v, "NULL"))
+		}
+		fmt.Fprintln(w, strings.Join(vals, "\t"))
+	}
+	return w.Flush()
+}
+
+// jsonEncoder returns a JSON encoder writing indented output to w
+func jsonEncoder(w io.Writer) *json.Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc
+}
+
+// list writes a single column of names
+func (o output) list(column string, names []string) error {
+	rows := make([][]interface{}, len(names))
+	for i, n := range names {
+		rows[i] = []interface{}{n}
+	}
+	return o.table([]string{column}, rows)
+}
+
+// text returns a value as text, using null for NULLs
+func text(v interface{}, null string) string {
+	switch v := v.(type) {
+	case nil:
+		return null
+	case string:
+		return v
+	case []byte:
+		return "X'" + strings.ToUpper(hex.EncodeToString(v)) + "'"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format("2006-01-02 15:04:05 MST")
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonRow is a row of results, written as a JSON object with the columns in order
+type jsonRow struct {
+	columns []string
+	values  []interface{}
+}
+
+func (r jsonRow) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, c := range r.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
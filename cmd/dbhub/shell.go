@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+// historySize is the number of entries kept in the shell's history file
+const historySize = 500
+
+// shellHelp lists the dot commands understood by the shell
+const shellHelp = `.checkout [VERSION]    Show the version being queried, or switch to another (eg @branch, #commit, @tag:name)
+.help                  Show this help
+.history               List the previous statements and commands by number
+.indexes [TABLE]       List the indexes, optionally only those on TABLE
+.mode [table|json|csv] Show or change the output format
+.quit                  Leave the shell (.exit works too)
+.schema TABLE          List the columns in a table or view
+.tables                List the tables
+.views                 List the views
+
+SQL statements can span several lines, and are run once they end with a semicolon.  SELECT statements are run as
+read only queries, and anything else is run against the Live database.  Ctrl-C cancels the statement being run
+without leaving the shell.
+
+Previous statements and commands are kept between sessions.  Enter !N to run entry N of .history again, or !! for the
+most recent one.  There's no line editing or arrow key recall, but wrappers such as rlwrap can add them.
+`
+
+// shell is an interactive SQL session against a database
+type shell struct {
+	e       *env
+	ctx     context.Context // The context of the statement being run
+	conn    dbhub.Connection
+	ref     dbhub.Ref
+	history []string
+}
+
+// cmdShell runs an interactive SQL shell against a database
+func cmdShell(e *env, args []string) error {
+	conn, ref, _, err := e.refArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	sh := &shell{e: e, conn: conn, ref: ref}
+
+	// Interrupts only cancel the statement being run, so they're ignored while waiting for input
+	e.onInterrupt(nil)
+	histPath := historyPath()
+	if histPath != "" {
+		if sh.history, err = readHistory(histPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// Prompts are only shown to people, so scripts piped in get just the results
+	interactive := isTerminal(e.stdin)
+	if interactive {
+		fmt.Fprintf(e.stdout, "Connected to %s.  Enter \".help\" for usage hints.\n", ref)
+	}
+	scanner := bufio.NewScanner(e.stdin)
+	scanner.Buffer(nil, 16*1024*1024)
+	var pending string
+	for quit := false; !quit && e.ctx.Err() == nil; {
+		if interactive {
+			if pending == "" {
+				fmt.Fprintf(e.stdout, "%s> ", sh.ref)
+			} else {
+				fmt.Fprintf(e.stdout, "%*s> ", len(sh.ref.String()), "...")
+			}
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+
+		// Dot commands and history lookups are only recognised at the start of a statement
+		if pending == "" {
+			trimmed := strings.TrimSpace(line)
+			switch {
+			case trimmed == "":
+				continue
+			case strings.HasPrefix(trimmed, "!"):
+				entry, err := sh.lookup(trimmed[1:])
+				if err != nil {
+					fmt.Fprintf(e.stderr, "Error: %s\n", err)
+					continue
+				}
+				fmt.Fprintln(e.stdout, entry)
+				quit = sh.run(entry)
+				continue
+			case strings.HasPrefix(trimmed, "."):
+				quit = sh.run(trimmed)
+				continue
+			}
+		}
+
+		var stmts []string
+		stmts, pending = splitStatements(pending + line + "\n")
+		for _, s := range stmts {
+			sh.run(s)
+		}
+		if strings.TrimSpace(pending) == "" {
+			pending = ""
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	// Whatever's left at the end of the input is run as is, even without a semicolon
+	if s := strings.TrimSpace(pending); s != "" && e.ctx.Err() == nil {
+		sh.run(s)
+	}
+	if interactive {
+		fmt.Fprintln(e.stdout)
+	}
+	if histPath != "" {
+		return writeHistory(histPath, sh.history)
+	}
+	return nil
+}
+
+// run runs a SQL statement or dot command, adding it to the history.  Errors are shown rather than returned, so the
+// session carries on.  Returns true if the shell should quit.
+func (sh *shell) run(s string) (quit bool) {
+	sh.record(s)
+	var cancel context.CancelFunc
+	sh.ctx, cancel = context.WithCancel(sh.e.ctx)
+	sh.e.onInterrupt(cancel)
+	defer func() {
+		sh.e.onInterrupt(nil)
+		cancel()
+	}()
+
+	var err error
+	if strings.HasPrefix(s, ".") {
+		quit, err = sh.dotCommand(s)
+	} else {
+		err = sh.sql(s)
+	}
+	if err != nil && sh.ctx.Err() != nil && sh.e.ctx.Err() == nil {
+		err = errors.New("interrupted")
+	}
+	if err != nil {
+		fmt.Fprintf(sh.e.stderr, "Error: %s\n", err)
+	}
+	return
+}
+
+// sql runs a SQL statement.  Reads go through Query, and everything else through Execute, which only works for Live
+// databases.
+func (sh *shell) sql(s string) error {
+	e := sh.e
+	if isReadOnly(s) {
+		res, err := sh.conn.QueryTypedContext(sh.ctx, sh.ref.Owner, sh.ref.Name, sh.ref.Ident, s)
+		if err != nil {
+			return err
+		}
+		return e.out.results(res)
+	}
+	if sh.ref.Ident != (dbhub.Identifier{}) {
+		return fmt.Errorf("changes can only be made to Live databases, which don't have versions to check out")
+	}
+	n, err := sh.conn.ExecuteContext(sh.ctx, sh.ref.Owner, sh.ref.Name, s)
+	if err != nil {
+		return err
+	}
+	return e.out.rowsChanged(n)
+}
+
+// dotCommand runs one of the shell's dot commands.  Returns true if the shell should quit.
+func (sh *shell) dotCommand(s string) (quit bool, err error) {
+	e, ref := sh.e, sh.ref
+	fields := strings.Fields(s)
+	name, args := fields[0], fields[1:]
+	wantArgs := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return fmt.Errorf("wrong number of arguments for %s, see .help", name)
+		}
+		return nil
+	}
+	switch name {
+	case ".checkout":
+		if err = wantArgs(0, 1); err != nil {
+			return
+		}
+		if len(args) == 0 {
+			fmt.Fprintln(e.stdout, ref)
+			return
+		}
+		return false, sh.checkout(args[0])
+	case ".help":
+		fmt.Fprint(e.stdout, shellHelp)
+	case ".history":
+		if err = wantArgs(0, 0); err != nil {
+			return
+		}
+		for i, entry := range sh.history {
+			fmt.Fprintf(e.stdout, "%5d  %s\n", i+1, strings.ReplaceAll(entry, "\n", "\n       "))
+		}
+	case ".indexes":
+		if err = wantArgs(0, 1); err != nil {
+			return
+		}
+		var indexes []dbhub.APIJSONIndex
+		if indexes, err = sh.conn.IndexesContext(sh.ctx, ref.Owner, ref.Name, ref.Ident); err != nil {
+			return
+		}
+		if len(args) == 1 {
+			var matches []dbhub.APIJSONIndex
+			for _, idx := range indexes {
+				if strings.EqualFold(idx.Table, args[0]) {
+					matches = append(matches, idx)
+				}
+			}
+			indexes = matches
+		}
+		err = e.out.indexes(indexes)
+	case ".mode":
+		if err = wantArgs(0, 1); err != nil {
+			return
+		}
+		if len(args) == 0 {
+			fmt.Fprintln(e.stdout, e.out.format)
+			return
+		}
+		o := output{format: args[0], w: e.out.w}
+		if err = o.check(); err == nil {
+			e.out = o
+		}
+	case ".quit", ".exit":
+		return true, nil
+	case ".schema":
+		if err = wantArgs(1, 1); err != nil {
+			return
+		}
+		var columns []dbhub.APIJSONColumn
+		if columns, err = sh.conn.ColumnsContext(sh.ctx, ref.Owner, ref.Name, ref.Ident, args[0]); err != nil {
+			return
+		}
+		err = e.out.columns(columns)
+	case ".tables":
+		if err = wantArgs(0, 0); err != nil {
+			return
+		}
+		var tables []string
+		if tables, err = sh.conn.TablesContext(sh.ctx, ref.Owner, ref.Name, ref.Ident); err != nil {
+			return
+		}
+		err = e.out.list("table", tables)
+	case ".views":
+		if err = wantArgs(0, 0); err != nil {
+			return
+		}
+		var views []string
+		if views, err = sh.conn.ViewsContext(sh.ctx, ref.Owner, ref.Name, ref.Ident); err != nil {
+			return
+		}
+		err = e.out.list("view", views)
+	default:
+		err = fmt.Errorf("unknown command '%s', enter \".help\" for the list of commands", name)
+	}
+	return
+}
+
+// checkout switches the shell to another version of the database.  The version is checked to exist first, so
+// typos are caught straight away rather than on the next query.
+func (sh *shell) checkout(version string) error {
+	if !strings.HasPrefix(version, "@") && !strings.HasPrefix(version, "#") {
+		version = "@" + version
+	}
+	ref, err := versionRef(sh.ref, version)
+	if err != nil {
+		return err
+	}
+	commitID, err := sh.conn.ResolveContext(sh.ctx, ref.Owner, ref.Name, ref.Ident)
+	if err != nil {
+		return err
+	}
+	sh.ref = ref
+	fmt.Fprintf(sh.e.stderr, "Switched to %s (commit %s)\n", ref, commitID)
+	return nil
+}
+
+// record adds an entry to the history, unless it's the same as the last one.  Statements are kept with their line
+// breaks, as joining the lines would comment out everything after a "--" comment.
+func (sh *shell) record(s string) {
+	if n := len(sh.history); n > 0 && sh.history[n-1] == s {
+		return
+	}
+	sh.history = append(sh.history, s)
+}
+
+// lookup returns a history entry from its number, as shown by .history.  "!" is the most recent entry, and negative
+// numbers count back from it.
+func (sh *shell) lookup(s string) (entry string, err error) {
+	n := -1
+	if s != "!" {
+		if n, err = strconv.Atoi(s); err != nil {
+			return "", fmt.Errorf("'!%s' should be !N, where N is an entry number from .history", s)
+		}
+	}
+	if n < 0 {
+		n += len(sh.history) + 1
+	}
+	if n < 1 || n > len(sh.history) {
+		return "", fmt.Errorf("there's no history entry %s", s)
+	}
+	return sh.history[n-1], nil
+}
+
+// isReadOnly returns true if a statement only reads from the database, so can be run with Query
+func isReadOnly(sql string) bool {
+	sql = skipSpaceAndComments(sql)
+	end := strings.IndexFunc(sql, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	if end >= 0 {
+		sql = sql[:end]
+	}
+	switch strings.ToUpper(sql) {
+	case "SELECT", "WITH", "VALUES", "EXPLAIN":
+		return true
+	}
+	return false
+}
+
+// skipSpaceAndComments returns sql with any leading white space and comments removed
+func skipSpaceAndComments(sql string) string {
+	for {
+		sql = strings.TrimSpace(sql)
+		switch {
+		case strings.HasPrefix(sql, "--"):
+			if i := strings.IndexByte(sql, '\n'); i >= 0 {
+				sql = sql[i+1:]
+				continue
+			}
+			return ""
+		case strings.HasPrefix(sql, "/*"):
+			if i := strings.Index(sql[2:], "*/"); i >= 0 {
+				sql = sql[i+4:]
+				continue
+			}
+			return ""
+		}
+		return sql
+	}
+}
+
+// splitStatements splits off the complete statements at the start of some SQL, which are those ending in a
+// semicolon.  Semicolons inside quotes and comments don't count.  The incomplete remainder is returned as rest.
+func splitStatements(sql string) (stmts []string, rest string) {
+	start := 0
+	for i := 0; i < len(sql); i++ {
+		var end string
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end = string(c)
+		case c == '[':
+			end = "]"
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end = "\n"
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end = "*/"
+			i++
+		case c == ';':
+			if s := strings.TrimSpace(sql[start:i]); s != "" {
+				stmts = append(stmts, s)
+			}
+			start = i + 1
+			continue
+		default:
+			continue
+		}
+
+		// Skip to the end of the quoted text or comment.  Doubled quotes are just two quoted strings in a row as far
+		// as this is concerned, which works out the same.
+		j := strings.Index(sql[i+1:], end)
+		if j < 0 {
+			break
+		}
+		i += j + len(end)
+	}
+	if start < len(sql) {
+		rest = sql[start:]
+	}
+	return
+}
+
+// historyPath returns the location of the shell's history file, following the XDG base directory spec
+func historyPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "dbhub", "history")
+}
+
+// readHistory reads the entries in a history file, one per line.  Entries written quoted by writeHistory are
+// unquoted.
+func readHistory(path string) (history []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, `"`) {
+			if entry, err := strconv.Unquote(line); err == nil {
+				line = entry
+			}
+		}
+		if line != "" {
+			history = append(history, line)
+		}
+	}
+	return
+}
+
+// writeHistory saves the most recent history entries to a file.  The file is only readable by its owner, as the
+// statements in it can include data.
+func writeHistory(path string, history []string) error {
+	if len(history) > historySize {
+		history = history[len(history)-historySize:]
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	var buf strings.Builder
+	for _, entry := range history {
+		// Entries spanning several lines are written as quoted strings, so each one still takes a single line
+		if strings.ContainsAny(entry, "\r\n") || strings.HasPrefix(entry, `"`) {
+			entry = strconv.Quote(entry)
+		}
+		buf.WriteString(entry + "\n")
+	}
+	return os.WriteFile(path, []byte(buf.String()), 0600)
+}
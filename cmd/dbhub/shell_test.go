@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShell verifies running statements and dot commands in the shell
+func TestShell(t *testing.T) {
+	te := newTestEnv(t)
+
+	// Statements can span lines and share them, and dot commands work in whichever output mode is chosen
+	te.stdin = `.mode csv
+SELECT name FROM people
+  WHERE id = 1; SELECT 'a;b' AS "x;y";
+.tables
+.views
+.indexes people
+.schema people
+.checkout @tag:v1
+SELECT age FROM people WHERE id = 1;
+.checkout
+.mode
+!5
+SELECT count(*) AS n FROM people`
+	code, stdout, stderr := te.run("shell", "default/test.sqlite")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, `name
+Alice
+x;y
+a;b
+table
+people
+view
+adults
+index,table,columns
+people_name,people,name
+name,type,not_null,default,primary_key
+id,INTEGER,false,,1
+name,TEXT,true,,0
+age,INTEGER,false,,0
+age
+30
+default/test.sqlite@tag:v1
+csv
+.views
+view
+n
+2
+`, stdout)
+	assert.Equal(t, "Switched to default/test.sqlite@tag:v1 (commit "+te.commit1+")\n", stderr)
+
+	// The history is saved for next time, with multi-line statements quoted to keep them on one line
+	data, err := os.ReadFile(filepath.Join(te.home, ".local", "state", "dbhub", "history"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\n\"SELECT name FROM people\\n  WHERE id = 1\"\n")
+	te.stdin = ".history\n"
+	assert.Contains(t, te.ok(t, "shell", "default/test.sqlite"), "    2  SELECT name FROM people\n         WHERE id = 1\n")
+
+	// Statements are run again with their line breaks, so comments don't swallow the rest of the statement
+	te.stdin = "SELECT name -- the name\nFROM people WHERE id = 3;\n!!\n"
+	code, stdout, stderr = te.run("-format", "csv", "shell", "default/test.sqlite")
+	require.Equal(t, 0, code, stderr)
+	assert.Empty(t, stderr)
+	assert.Equal(t, "name\nCarol\nSELECT name -- the name\nFROM people WHERE id = 3\nname\nCarol\n", stdout)
+
+	// Changes go to Live databases, and errors don't end the session
+	te.stdin = `UPDATE t SET b = 'changed' WHERE a = 1;
+SELECT * FROM missing;
+.bogus
+SELECT b FROM t ORDER BY a;
+.quit
+SELECT 1;`
+	code, stdout, stderr = te.run("-format", "csv", "shell", "default/live.sqlite")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "rows_changed\n1\nb\nchanged\ntwo\n", stdout)
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "Error: "))
+	assert.Equal(t, "Error: unknown command '.bogus', enter \".help\" for the list of commands", lines[1])
+
+	// Changes can't be made to older versions
+	te.stdin = ".checkout main\nDELETE FROM people;\n"
+	_, _, stderr = te.run("shell", "default/test.sqlite")
+	assert.Contains(t, stderr, "Error: changes can only be made to Live databases")
+}
+
+// TestShellInterrupt verifies an interrupt cancels the statement being run, but not the rest of the session
+func TestShellInterrupt(t *testing.T) {
+	te := newTestEnv(t)
+	te.srv.Script("/v1/query", dbhubtest.Fault{ResponseDelay: time.Minute})
+	stdin, input := io.Pipe()
+	interrupts := make(chan os.Signal, 1)
+	var stdout, stderr bytes.Buffer
+	done := make(chan int)
+	go func() {
+		done <- run(context.Background(), interrupts, []string{"-format", "csv", "shell", "default/test.sqlite"},
+			stdin, &stdout, &stderr)
+	}()
+
+	// Interrupt the slow query once the server has received it, then carry on with another
+	_, err := io.WriteString(input, "SELECT name FROM people;\n")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return te.srv.Calls("/v1/query") == 1 }, 5*time.Second, time.Millisecond)
+	interrupts <- os.Interrupt
+	_, err = io.WriteString(input, "SELECT count(*) AS n FROM people;\n")
+	require.NoError(t, err)
+	require.NoError(t, input.Close())
+	select {
+	case code := <-done:
+		require.Equal(t, 0, code, stderr.String())
+	case <-time.After(10 * time.Second):
+		t.Fatal("the shell didn't finish after the statement was interrupted")
+	}
+	assert.Equal(t, "Error: interrupted\n", stderr.String())
+	assert.Equal(t, "n\n2\n", stdout.String())
+}
+
+// TestSplitStatements verifies finding the ends of statements
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		sql   string
+		stmts []string
+		rest  string
+	}{
+		{"SELECT 1", nil, "SELECT 1"},
+		{"SELECT 1; SELECT 2;\n", []string{"SELECT 1", "SELECT 2"}, "\n"},
+		{"SELECT ';'; SELECT", []string{"SELECT ';'"}, " SELECT"},
+		{"SELECT \"a;\", [b;], `c;` ;", []string{"SELECT \"a;\", [b;], `c;`"}, ""},
+		{"SELECT 1 -- comment;\n;", []string{"SELECT 1 -- comment;"}, ""},
+		{"SELECT /* ; */ 1;", []string{"SELECT /* ; */ 1"}, ""},
+		{"SELECT 'it''s;", nil, "SELECT 'it''s;"},
+		{";;", nil, ""},
+	}
+	for _, test := range tests {
+		stmts, rest := splitStatements(test.sql)
+		assert.Equal(t, test.stmts, stmts, test.sql)
+		assert.Equal(t, test.rest, rest, test.sql)
+	}
+
+	assert.True(t, isReadOnly("  -- comment\n/* more */ select 1"))
+	assert.True(t, isReadOnly("WITH x AS (SELECT 1) SELECT * FROM x"))
+	assert.False(t, isReadOnly("INSERT INTO t VALUES (1)"))
+	assert.False(t, isReadOnly("SELECTED"))
+}
@@ -0,0 +1,254 @@
+package dbhub
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// DefaultProfile is the name of the profile used when none is given, and DBHUB_PROFILE isn't set
+const DefaultProfile = "default"
+
+// Profile holds a set of connection settings, as read from the config file and environment
+type Profile struct {
+	Name       string
+	Server     string // Left empty for the public DBHub.io server
+	Key        string
+	KeyCommand string   // A shell command which prints the API key, used when Key isn't set
+	CAFile     string   // A PEM file of the certificate authorities to trust for the server's certificate
+	ClientCert string   // A PEM file holding a client certificate to present to the server
+	ClientKey  string   // A PEM file holding the key of the client certificate, if it's not in ClientCert
+	Pins       []string // Pinned server keys, as used by WithPinnedKeys()
+	SkipVerify bool     // Don't verify the server's certificate.  Only useful for testing and development.
+}
+
+// ConfigPath returns the location of the config file.  This is dbhub/config in $XDG_CONFIG_HOME, which defaults to
+// ~/.config.
+func ConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "dbhub", "config")
+}
+
+// NewFromEnv creates a new connection using the API key in DBHUB_API_KEY, along with the server in DBHUB_SERVER and
+// DBHUB_VERIFY_CERT if they're set.  The config file isn't used.
+func NewFromEnv(opts ...Option) (Connection, error) {
+	p := Profile{Name: "environment"}
+	if err := p.readEnv(); err != nil {
+		return Connection{}, err
+	}
+	if p.Key == "" {
+		return Connection{}, fmt.Errorf("no API key found, as DBHUB_API_KEY isn't set")
+	}
+	return NewFromProfile(p, opts...)
+}
+
+// NewFromConfig creates a new connection using a profile from the config file, as returned by LoadProfile()
+func NewFromConfig(profile string, opts ...Option) (Connection, error) {
+	p, err := LoadProfile(profile)
+	if err != nil {
+		return Connection{}, err
+	}
+	return NewFromProfile(p, opts...)
+}
+
+// LoadProfile reads a profile from the config file.  An empty name means the profile named in DBHUB_PROFILE, or the
+// default profile if that isn't set either.  When the default profile is used because no profile was named, the
+// DBHUB_API_KEY, DBHUB_SERVER, and DBHUB_VERIFY_CERT environment variables override the settings in the file.  Named
+// profiles ignore them, so an API key meant for one server is never sent to the server of another profile.
+//
+// The config file holds "name = value" settings, one per line, with named profiles starting at a "[name]" line.
+// Settings before the first profile belong to the default profile.  Blank lines and lines starting with "#" are
+// ignored.  For example:
+//
+//	key = YOUR_API_KEY_HERE
+//
+//	[work]
+//	server = https://dbhub.example.com:5550
+//	key_command = pass show dbhub/work
+//	ca_file = /etc/ssl/certs/example-ca.pem
+//	client_cert = work-client.pem
+//	client_key = work-client.key
+//	pin_sha256 = 4U6Y3JRbWt9ptbMUrjTOBAgUSQvC5/l7tnfgE6m3hbY=
+//	verify_cert = true
+//
+// Relative file names are taken to be in the same directory as the config file, and pin_sha256 can be given more than
+// once to pin several keys.  A missing config file is only an error when a profile other than the default one is asked
+// for.
+func LoadProfile(name string) (p Profile, err error) {
+	if name == "" {
+		name = os.Getenv("DBHUB_PROFILE")
+	}
+	named := name != ""
+	if !named {
+		name = DefaultProfile
+	}
+	var profiles map[string]Profile
+	path := ConfigPath()
+	if path != "" {
+		if profiles, err = readConfig(path); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		err = nil
+	}
+	p, ok := profiles[name]
+	if !ok && name != DefaultProfile {
+		return Profile{}, fmt.Errorf("there's no profile named '%s' in the config file %s", name, path)
+	}
+	p.Name = name
+	if !named {
+		err = p.readEnv()
+	}
+	return
+}
+
+// NewFromProfile creates a new connection using the settings in a profile.  The options are applied after the
+// profile's own settings.
+func NewFromProfile(p Profile, opts ...Option) (c Connection, err error) {
+	key := p.Key
+	if key == "" && p.KeyCommand != "" {
+		if key, err = runKeyCommand(p.KeyCommand); err != nil {
+			return Connection{}, fmt.Errorf("getting the API key for profile '%s' failed: %w", p.Name, err)
+		}
+	}
+	if key == "" {
+		return Connection{}, fmt.Errorf("profile '%s' has no API key.  Add a key or key_command setting to the "+
+			"config file, or for the default profile set DBHUB_API_KEY", p.Name)
+	}
+	var profileOpts []Option
+	if p.CAFile != "" {
+		profileOpts = append(profileOpts, WithCACertFile(p.CAFile))
+	}
+	if p.ClientCert != "" {
+		profileOpts = append(profileOpts, WithClientCert(p.ClientCert, p.ClientKey))
+	}
+	if len(p.Pins) != 0 {
+		profileOpts = append(profileOpts, WithPinnedKeys(p.Pins...))
+	}
+	opts = append(profileOpts, opts...)
+	if c, err = New(key, opts...); err != nil {
+		return Connection{}, err
+	}
+	if p.Server != "" {
+		c.ChangeServer(strings.TrimSuffix(p.Server, "/"))
+	}
+	c.ChangeVerifyServerCert(!p.SkipVerify)
+	return
+}
+
+// readEnv overrides the profile's settings with any set in the environment
+func (p *Profile) readEnv() error {
+	if v := os.Getenv("DBHUB_API_KEY"); v != "" {
+		p.Key = v
+	}
+	if v := os.Getenv("DBHUB_SERVER"); v != "" {
+		p.Server = v
+	}
+	if v := os.Getenv("DBHUB_VERIFY_CERT"); v != "" {
+		verify, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid DBHUB_VERIFY_CERT value '%s'", v)
+		}
+		p.SkipVerify = !verify
+	}
+	return nil
+}
+
+// readConfig reads the profiles in a config file
+func readConfig(path string) (profiles map[string]Profile, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	profiles = make(map[string]Profile)
+	name := DefaultProfile
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name = strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, fmt.Errorf("%s:%d: the profile has no name", path, n)
+			}
+			continue
+		}
+		setting, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: settings should be written as name = value", path, n)
+		}
+		setting, value = strings.TrimSpace(setting), strings.TrimSpace(value)
+		p := profiles[name]
+		switch setting {
+		case "key":
+			p.Key = value
+		case "key_command":
+			p.KeyCommand = value
+		case "server":
+			p.Server = value
+		case "ca_file":
+			p.CAFile = configFile(path, value)
+		case "client_cert":
+			p.ClientCert = configFile(path, value)
+		case "client_key":
+			p.ClientKey = configFile(path, value)
+		case "pin_sha256":
+			p.Pins = append(p.Pins, value)
+		case "verify_cert":
+			verify, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid verify_cert value '%s'", path, n, value)
+			}
+			p.SkipVerify = !verify
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown setting '%s'", path, n, setting)
+		}
+		profiles[name] = p
+	}
+	err = scanner.Err()
+	return
+}
+
+// configFile returns the path of a file named in the config file.  Relative paths are taken to be relative to the
+// config file's directory.
+func configFile(configPath, name string) string {
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(configPath), name)
+}
+
+// runKeyCommand runs a command which prints an API key, such as one reading it from a password manager
+func runKeyCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
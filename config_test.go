@@ -0,0 +1,161 @@
+package dbhub_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearConfigEnv points the config file at an empty directory and clears the connection settings in the environment,
+// returning the location of the config file
+func clearConfigEnv(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	for _, name := range []string{"DBHUB_API_KEY", "DBHUB_SERVER", "DBHUB_VERIFY_CERT", "DBHUB_PROFILE"} {
+		t.Setenv(name, "")
+	}
+	path := filepath.Join(dir, "dbhub", "config")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	return path
+}
+
+// TestNewFromEnv verifies connections created using the environment variables
+func TestNewFromEnv(t *testing.T) {
+	clearConfigEnv(t)
+	srv := dbhubtest.NewServer()
+	defer srv.Close()
+
+	_, err := dbhub.NewFromEnv()
+	assert.EqualError(t, err, "no API key found, as DBHUB_API_KEY isn't set")
+
+	t.Setenv("DBHUB_API_KEY", dbhubtest.DefaultAPIKey)
+	t.Setenv("DBHUB_SERVER", srv.URL+"/")
+	t.Setenv("DBHUB_VERIFY_CERT", "false")
+	conn, err := dbhub.NewFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL, conn.Server)
+	assert.False(t, conn.VerifyServerCert)
+	_, err = conn.Databases()
+	require.NoError(t, err)
+
+	t.Setenv("DBHUB_VERIFY_CERT", "sometimes")
+	_, err = dbhub.NewFromEnv()
+	assert.EqualError(t, err, "invalid DBHUB_VERIFY_CERT value 'sometimes'")
+}
+
+// TestNewFromConfig verifies connections created using profiles from the config file
+func TestNewFromConfig(t *testing.T) {
+	path := clearConfigEnv(t)
+	srv := dbhubtest.NewServer()
+	defer srv.Close()
+
+	// Without a config file, only the default profile can be used
+	_, err := dbhub.NewFromConfig("")
+	assert.ErrorContains(t, err, "profile 'default' has no API key")
+	_, err = dbhub.NewFromConfig("work")
+	assert.ErrorContains(t, err, "there's no profile named 'work'")
+
+	require.NoError(t, os.WriteFile(path, []byte(`# Settings before any profile are the default ones
+key = wrong
+server = `+srv.URL+`
+
+[work]
+server = `+srv.URL+`/
+key_command = echo "  `+dbhubtest.DefaultAPIKey+`"
+verify_cert = false
+
+[broken]
+key_command = echo oops >&2; exit 1
+`), 0600))
+	p, err := dbhub.LoadProfile("work")
+	require.NoError(t, err)
+	assert.Equal(t, dbhub.Profile{Name: "work", Server: srv.URL + "/", KeyCommand: `echo "  ` +
+		dbhubtest.DefaultAPIKey + `"`, SkipVerify: true}, p)
+	conn, err := dbhub.NewFromConfig("work")
+	require.NoError(t, err)
+	assert.Equal(t, dbhubtest.DefaultAPIKey, conn.APIKey)
+	assert.Equal(t, srv.URL, conn.Server)
+	assert.False(t, conn.VerifyServerCert)
+	_, err = conn.Databases()
+	require.NoError(t, err)
+
+	// The default profile is used when none is named, and the environment overrides the file
+	conn, err = dbhub.NewFromConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, "wrong", conn.APIKey)
+	assert.True(t, conn.VerifyServerCert)
+	t.Setenv("DBHUB_API_KEY", "from-env")
+	t.Setenv("DBHUB_SERVER", "https://api.dbhub.io")
+	conn, err = dbhub.NewFromConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", conn.APIKey)
+	assert.Equal(t, "https://api.dbhub.io", conn.Server)
+
+	// But a named profile keeps its own settings, so the key from the environment isn't sent to the profile's server
+	for _, name := range []string{"work", "default"} {
+		conn, err = dbhub.NewFromConfig(name)
+		require.NoError(t, err)
+		assert.NotEqual(t, "from-env", conn.APIKey, name)
+		assert.Equal(t, srv.URL, conn.Server, name)
+	}
+	t.Setenv("DBHUB_PROFILE", "work")
+	conn, err = dbhub.NewFromConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, dbhubtest.DefaultAPIKey, conn.APIKey)
+	assert.Equal(t, srv.URL, conn.Server)
+	assert.False(t, conn.VerifyServerCert)
+	t.Setenv("DBHUB_PROFILE", "")
+	t.Setenv("DBHUB_SERVER", "")
+
+	t.Setenv("DBHUB_API_KEY", "")
+	_, err = dbhub.NewFromConfig("broken")
+	assert.EqualError(t, err, "getting the API key for profile 'broken' failed: exit status 1: oops")
+
+	// Mistakes in the config file are reported with their line
+	require.NoError(t, os.WriteFile(path, []byte("[work]\nkey: abc\n"), 0600))
+	_, err = dbhub.LoadProfile("work")
+	assert.EqualError(t, err, path+":2: settings should be written as name = value")
+	require.NoError(t, os.WriteFile(path, []byte("colour = blue\n"), 0600))
+	_, err = dbhub.LoadProfile("")
+	assert.EqualError(t, err, path+":1: unknown setting 'colour'")
+}
+
+// TestCACertFile verifies servers with certificates from a private certificate authority can be trusted
+func TestCACertFile(t *testing.T) {
+	path := clearConfigEnv(t)
+	srv := newTLSServer(t, nil)
+
+	// The server's certificate isn't trusted by default
+	conn, err := dbhub.New("key")
+	require.NoError(t, err)
+	conn.ChangeServer(srv.URL)
+	_, err = conn.Databases()
+	assert.Error(t, err)
+
+	// Trusting it with a profile, where a relative path is taken from the config file's directory
+	caFile := filepath.Join(filepath.Dir(path), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, serverPEM(srv), 0600))
+	require.NoError(t, os.WriteFile(path, []byte("key = key\nserver = "+srv.URL+"\nca_file = ca.pem\n"), 0600))
+	conn, err = dbhub.NewFromConfig("")
+	require.NoError(t, err)
+	dbs, err := conn.Databases()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.db"}, dbs)
+
+	// Pinned keys are checked too
+	require.NoError(t, os.WriteFile(path, []byte("key = key\nserver = "+srv.URL+"\nca_file = ca.pem\n"+
+		"pin_sha256 = 4U6Y3JRbWt9ptbMUrjTOBAgUSQvC5/l7tnfgE6m3hbY=\n"), 0600))
+	conn, err = dbhub.NewFromConfig("")
+	require.NoError(t, err)
+	_, err = conn.Databases()
+	assert.ErrorIs(t, err, dbhub.ErrPinMismatch)
+
+	// Files without certificates are rejected
+	_, err = dbhub.New("key", dbhub.WithCACertFile(path))
+	assert.EqualError(t, err, "no certificates found in the CA file "+path)
+}
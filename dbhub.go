@@ -3,12 +3,14 @@ package dbhub
 // A Go library for working with databases on DBHub.io
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
-	"time"
 )
 
 const (
@@ -16,13 +18,19 @@ const (
 )
 
 // New creates a new DBHub.io connection object.  It doesn't connect to DBHub.io to do this.  Connection only occurs
-// when subsequent functions (eg Query()) are called.
-func New(key string) (Connection, error) {
+// when subsequent functions (eg Query()) are called.  Optional behaviour, such as using a custom http.Client, can be
+// configured by passing in Option values.
+func New(key string, opts ...Option) (Connection, error) {
 	c := Connection{
 		APIKey:           key,
 		Server:           "https://api.dbhub.io",
 		VerifyServerCert: true,
 	}
+	for _, opt := range opts {
+		if err := opt(&c); err != nil {
+			return Connection{}, err
+		}
+	}
 	return c, nil
 }
 
@@ -37,19 +45,25 @@ func (c *Connection) ChangeServer(s string) {
 }
 
 // ChangeVerifyServerCert changes whether to verify the server provided https certificate.  Useful for testing and development.
+// For self-hosted servers, trusting their certificate authority with WithCACertFile() is a better choice.  Connections
+// using a caller provided http client or transport aren't affected by this.
 func (c *Connection) ChangeVerifyServerCert(b bool) {
 	c.VerifyServerCert = b
 }
 
 // Branches returns a list of all available branches of a database along with the name of the default branch
 func (c Connection) Branches(dbOwner, dbName string) (branches map[string]BranchEntry, defaultBranch string, err error) {
+	return c.BranchesContext(context.Background(), dbOwner, dbName)
+}
+
+// BranchesContext is like Branches, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) BranchesContext(ctx context.Context, dbOwner, dbName string) (branches map[string]BranchEntry, defaultBranch string, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, Identifier{})
 
 	// Fetch the list of branches and the default branch
 	var response BranchListResponseContainer
-	queryUrl := c.Server + "/v1/branches"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &response)
+	err = c.sendRequestJSON(ctx, "/v1/branches", data, &response)
 
 	// Extract information for return values
 	branches = response.Branches
@@ -59,62 +73,85 @@ func (c Connection) Branches(dbOwner, dbName string) (branches map[string]Branch
 
 // Columns returns the column information for a given table or view
 func (c Connection) Columns(dbOwner, dbName string, ident Identifier, table string) (columns []APIJSONColumn, err error) {
+	return c.ColumnsContext(context.Background(), dbOwner, dbName, ident, table)
+}
+
+// ColumnsContext is like Columns, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) ColumnsContext(ctx context.Context, dbOwner, dbName string, ident Identifier, table string) (columns []APIJSONColumn, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, ident)
 	data.Set("table", table)
 
 	// Fetch the list of columns
-	queryUrl := c.Server + "/v1/columns"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &columns)
+	err = c.sendRequestJSON(ctx, "/v1/columns", data, &columns)
 	return
 }
 
 // Commits returns the details of all commits for a database
 func (c Connection) Commits(dbOwner, dbName string) (commits map[string]CommitEntry, err error) {
+	return c.CommitsContext(context.Background(), dbOwner, dbName)
+}
+
+// CommitsContext is like Commits, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) CommitsContext(ctx context.Context, dbOwner, dbName string) (commits map[string]CommitEntry, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, Identifier{})
 
 	// Fetch the commits
-	queryUrl := c.Server + "/v1/commits"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &commits)
+	err = c.sendRequestJSON(ctx, "/v1/commits", data, &commits)
 	return
 }
 
 // Databases returns the list of standard databases in your account
 func (c Connection) Databases() (databases []string, err error) {
+	return c.DatabasesContext(context.Background())
+}
+
+// DatabasesContext is like Databases, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) DatabasesContext(ctx context.Context) (databases []string, err error) {
 	// Prepare the API parameters
 	data := url.Values{}
 	data.Set("apikey", c.APIKey)
 
 	// Fetch the list of databases
-	queryUrl := c.Server + "/v1/databases"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &databases)
+	err = c.sendRequestJSON(ctx, "/v1/databases", data, &databases)
 	return
 }
 
 // DatabasesLive returns the list of Live databases in your account
 func (c Connection) DatabasesLive() (databases []string, err error) {
+	return c.DatabasesLiveContext(context.Background())
+}
+
+// DatabasesLiveContext is like DatabasesLive, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) DatabasesLiveContext(ctx context.Context) (databases []string, err error) {
 	// Prepare the API parameters
 	data := url.Values{}
 	data.Set("apikey", c.APIKey)
 	data.Set("live", "true")
 
 	// Fetch the list of databases
-	queryUrl := c.Server + "/v1/databases"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &databases)
+	err = c.sendRequestJSON(ctx, "/v1/databases", data, &databases)
 	return
 }
 
 // Delete deletes a database in your account
 func (c Connection) Delete(dbName string) (err error) {
+	return c.DeleteContext(context.Background(), dbName)
+}
+
+// DeleteContext is like Delete, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) DeleteContext(ctx context.Context, dbName string) (err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals("", dbName, Identifier{})
 
 	// Delete the database
-	queryUrl := c.Server + "/v1/delete"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, nil)
-	if err != nil && err.Error() == "no rows in result set" { // Feels like a dodgy workaround
-		err = fmt.Errorf("Unknown database\n")
+	err = c.sendRequestJSON(ctx, "/v1/delete", data, nil)
+
+	// The server reports a missing database as a failed row lookup, so give a clearer message for that
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && errors.Is(err, ErrNotFound) {
+		apiErr.Msg = "Unknown database"
 	}
 	return
 }
@@ -122,6 +159,11 @@ func (c Connection) Delete(dbName string) (err error) {
 // Diff returns the differences between two commits of two databases, or if the details on the second database are left empty,
 // between two commits of the same database. You can also specify the merge strategy used for the generated SQL statements.
 func (c Connection) Diff(dbOwnerA, dbNameA string, identA Identifier, dbOwnerB, dbNameB string, identB Identifier, merge MergeStrategy) (diffs Diffs, err error) {
+	return c.DiffContext(context.Background(), dbOwnerA, dbNameA, identA, dbOwnerB, dbNameB, identB, merge)
+}
+
+// DiffContext is like Diff, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) DiffContext(ctx context.Context, dbOwnerA, dbNameA string, identA Identifier, dbOwnerB, dbNameB string, identB Identifier, merge MergeStrategy) (diffs Diffs, err error) {
 	// Prepare the API parameters
 	data := url.Values{}
 	data.Set("apikey", c.APIKey)
@@ -162,35 +204,58 @@ func (c Connection) Diff(dbOwnerA, dbNameA string, identA Identifier, dbOwnerB,
 	}
 
 	// Fetch the diffs
-	queryUrl := c.Server + "/v1/diff"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &diffs)
+	err = c.sendRequestJSON(ctx, "/v1/diff", data, &diffs)
 	return
 }
 
 // Download returns the database file
 func (c Connection) Download(dbOwner, dbName string, ident Identifier) (db io.ReadCloser, err error) {
+	return c.DownloadContext(context.Background(), dbOwner, dbName, ident)
+}
+
+// DownloadContext is like Download, but the request is bound to ctx so it can be cancelled or given a deadline.  The
+// returned stream is bound to ctx as well, so cancelling it also aborts reading the database file
+func (c Connection) DownloadContext(ctx context.Context, dbOwner, dbName string, ident Identifier) (db io.ReadCloser, err error) {
+	// Use the cached copy of the database if there is one.  Live databases don't have commits, so they can't be cached
+	if c.cache != nil {
+		commitID, entry, resolveErr := c.resolveEntry(ctx, dbOwner, dbName, ident)
+		if resolveErr == nil {
+			return c.downloadCached(ctx, dbOwner, dbName, commitID, entry)
+		}
+		if errors.Is(resolveErr, ErrNotFound) || errors.Is(resolveErr, ErrUnauthorized) ||
+			errors.Is(resolveErr, ErrAmbiguousIdentifier) {
+			err = resolveErr
+			return
+		}
+	}
+
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, ident)
 
 	// Fetch the database file
-	queryUrl := c.Server + "/v1/download"
-	db, err = sendRequest(queryUrl, c.VerifyServerCert, data)
+	var resp *http.Response
+	resp, err = c.post(ctx, "/v1/download", data, nil)
 	if err != nil {
 		return
 	}
+	db = newProgressReadCloser(resp.Body, c.options().progress, "/v1/download", dbName, resp.ContentLength)
 	return
 }
 
 // Execute executes a SQL statement (INSERT, UPDATE, DELETE) on the chosen database.
 func (c Connection) Execute(dbOwner, dbName string, sql string) (rowsChanged int, err error) {
+	return c.ExecuteContext(context.Background(), dbOwner, dbName, sql)
+}
+
+// ExecuteContext is like Execute, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) ExecuteContext(ctx context.Context, dbOwner, dbName string, sql string) (rowsChanged int, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, Identifier{})
 	data.Set("sql", base64.StdEncoding.EncodeToString([]byte(sql)))
 
 	// Run the query on the remote database
 	var execResponse ExecuteResponseContainer
-	queryUrl := c.Server + "/v1/execute"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &execResponse)
+	err = c.sendRequestJSON(ctx, "/v1/execute", data, &execResponse)
 	if err != nil {
 		return
 	}
@@ -200,23 +265,31 @@ func (c Connection) Execute(dbOwner, dbName string, sql string) (rowsChanged int
 
 // Indexes returns the list of indexes present in the database, along with the table they belong to
 func (c Connection) Indexes(dbOwner, dbName string, ident Identifier) (idx []APIJSONIndex, err error) {
+	return c.IndexesContext(context.Background(), dbOwner, dbName, ident)
+}
+
+// IndexesContext is like Indexes, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) IndexesContext(ctx context.Context, dbOwner, dbName string, ident Identifier) (idx []APIJSONIndex, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, ident)
 
 	// Fetch the list of indexes
-	queryUrl := c.Server + "/v1/indexes"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &idx)
+	err = c.sendRequestJSON(ctx, "/v1/indexes", data, &idx)
 	return
 }
 
 // Metadata returns the metadata (branches, releases, tags, commits, etc) for the database
 func (c Connection) Metadata(dbOwner, dbName string) (meta MetadataResponseContainer, err error) {
+	return c.MetadataContext(context.Background(), dbOwner, dbName)
+}
+
+// MetadataContext is like Metadata, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) MetadataContext(ctx context.Context, dbOwner, dbName string) (meta MetadataResponseContainer, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, Identifier{})
 
 	// Fetch the list of databases
-	queryUrl := c.Server + "/v1/metadata"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &meta)
+	err = c.sendRequestJSON(ctx, "/v1/metadata", data, &meta)
 	return
 }
 
@@ -253,14 +326,18 @@ func (c Connection) PrepareVals(dbOwner, dbName string, ident Identifier) (data
 // The "blobBase64" boolean specifies whether BLOB data fields should be base64 encoded in the output, or just skipped
 // using an empty string as a placeholder.
 func (c Connection) Query(dbOwner, dbName string, ident Identifier, blobBase64 bool, sql string) (out Results, err error) {
+	return c.QueryContext(context.Background(), dbOwner, dbName, ident, blobBase64, sql)
+}
+
+// QueryContext is like Query, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) QueryContext(ctx context.Context, dbOwner, dbName string, ident Identifier, blobBase64 bool, sql string) (out Results, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, ident)
 	data.Set("sql", base64.StdEncoding.EncodeToString([]byte(sql)))
 
 	// Run the query on the remote database
 	var returnedData []DataRow
-	queryUrl := c.Server + "/v1/query"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &returnedData)
+	err = c.sendRequestJSON(ctx, "/v1/query", data, &returnedData)
 	if err != nil {
 		return
 	}
@@ -299,118 +376,140 @@ func (c Connection) Query(dbOwner, dbName string, ident Identifier, blobBase64 b
 	return
 }
 
+// QueryInto runs a SQL query (SELECT only) on the chosen database, storing the result rows in dest.  dest must be a
+// pointer to a slice, usually of structs.  See TypedResults.Scan() for how the columns are matched up to struct fields.
+func (c Connection) QueryInto(dbOwner, dbName string, ident Identifier, sql string, dest interface{}) (err error) {
+	return c.QueryIntoContext(context.Background(), dbOwner, dbName, ident, sql, dest)
+}
+
+// QueryIntoContext is like QueryInto, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) QueryIntoContext(ctx context.Context, dbOwner, dbName string, ident Identifier, sql string, dest interface{}) (err error) {
+	var results TypedResults
+	results, err = c.QueryTypedContext(ctx, dbOwner, dbName, ident, sql)
+	if err != nil {
+		return
+	}
+	return results.Scan(dest)
+}
+
+// QueryTyped runs a SQL query (SELECT only) on the chosen database, returning the results with their column names and
+// native value types.  Each returned value is an int64, float64, string, []byte (for BLOBs), or nil (for NULLs).  See
+// TypedResults for the limits on the BLOB data the server can return.
+func (c Connection) QueryTyped(dbOwner, dbName string, ident Identifier, sql string) (out TypedResults, err error) {
+	return c.QueryTypedContext(context.Background(), dbOwner, dbName, ident, sql)
+}
+
+// QueryTypedContext is like QueryTyped, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) QueryTypedContext(ctx context.Context, dbOwner, dbName string, ident Identifier, sql string) (out TypedResults, err error) {
+	// Prepare the API parameters
+	data := c.PrepareVals(dbOwner, dbName, ident)
+	data.Set("sql", base64.StdEncoding.EncodeToString([]byte(sql)))
+
+	// Run the query on the remote database.  The numbers in the response are kept as json.Number, so large integers
+	// don't lose precision by being turned into floats
+	var body io.ReadCloser
+	body, err = c.sendRequest(ctx, "/v1/query", data)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	var returnedData []DataRow
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+	err = dec.Decode(&returnedData)
+	if err != nil {
+		return
+	}
+	return newTypedResults(returnedData)
+}
+
 // Releases returns the details of all releases for a database
 func (c Connection) Releases(dbOwner, dbName string) (releases map[string]ReleaseEntry, err error) {
+	return c.ReleasesContext(context.Background(), dbOwner, dbName)
+}
+
+// ReleasesContext is like Releases, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) ReleasesContext(ctx context.Context, dbOwner, dbName string) (releases map[string]ReleaseEntry, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, Identifier{})
 
 	// Fetch the releases
-	queryUrl := c.Server + "/v1/releases"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &releases)
+	err = c.sendRequestJSON(ctx, "/v1/releases", data, &releases)
 	return
 }
 
 // Tables returns the list of tables in the database
 func (c Connection) Tables(dbOwner, dbName string, ident Identifier) (tbl []string, err error) {
+	return c.TablesContext(context.Background(), dbOwner, dbName, ident)
+}
+
+// TablesContext is like Tables, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) TablesContext(ctx context.Context, dbOwner, dbName string, ident Identifier) (tbl []string, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, ident)
 
 	// Fetch the list of tables
-	queryUrl := c.Server + "/v1/tables"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &tbl)
+	err = c.sendRequestJSON(ctx, "/v1/tables", data, &tbl)
 	return
 }
 
 // Tags returns the details of all tags for a database
 func (c Connection) Tags(dbOwner, dbName string) (tags map[string]TagEntry, err error) {
+	return c.TagsContext(context.Background(), dbOwner, dbName)
+}
+
+// TagsContext is like Tags, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) TagsContext(ctx context.Context, dbOwner, dbName string) (tags map[string]TagEntry, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, Identifier{})
 
 	// Fetch the tags
-	queryUrl := c.Server + "/v1/tags"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &tags)
+	err = c.sendRequestJSON(ctx, "/v1/tags", data, &tags)
 	return
 }
 
 // Views returns the list of views in the database
 func (c Connection) Views(dbOwner, dbName string, ident Identifier) (views []string, err error) {
+	return c.ViewsContext(context.Background(), dbOwner, dbName, ident)
+}
+
+// ViewsContext is like Views, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) ViewsContext(ctx context.Context, dbOwner, dbName string, ident Identifier) (views []string, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, ident)
 
 	// Fetch the list of views
-	queryUrl := c.Server + "/v1/views"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &views)
+	err = c.sendRequestJSON(ctx, "/v1/views", data, &views)
 	return
 }
 
 // Upload uploads a new standard database, or a new revision of a database
 func (c Connection) Upload(dbName string, info UploadInformation, dbBytes *[]byte) (err error) {
+	return c.UploadContext(context.Background(), dbName, info, dbBytes)
+}
+
+// UploadContext is like Upload, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) UploadContext(ctx context.Context, dbName string, info UploadInformation, dbBytes *[]byte) (err error) {
 	// Prepare the API parameters
-	data := c.PrepareVals("", dbName, info.Ident)
-	data.Del("dbowner") // The upload function always stores the database in the account of the API key user
-	if info.CommitMsg != "" {
-		data.Set("commitmsg", info.CommitMsg)
-	}
-	if info.SourceURL != "" {
-		data.Set("sourceurl", info.SourceURL)
-	}
-	if !info.LastModified.IsZero() {
-		data.Set("lastmodified", info.LastModified.Format(time.RFC3339))
-	}
-	if info.Licence != "" {
-		data.Set("licence", info.Licence)
-	}
-	if info.Public != "" {
-		data.Set("public", info.Public)
-	}
-	if info.Force {
-		data.Set("force", "true")
-	}
-	if !info.CommitTimestamp.IsZero() {
-		data.Set("committimestamp", info.CommitTimestamp.Format(time.RFC3339))
-	}
-	if info.AuthorName != "" {
-		data.Set("authorname", info.AuthorName)
-	}
-	if info.AuthorEmail != "" {
-		data.Set("authoremail", info.AuthorEmail)
-	}
-	if info.CommitterName != "" {
-		data.Set("committername", info.CommitterName)
-	}
-	if info.CommitterEmail != "" {
-		data.Set("committeremail", info.CommitterEmail)
-	}
-	if info.OtherParents != "" {
-		data.Set("otherparents", info.OtherParents)
-	}
-	if info.ShaSum != "" {
-		data.Set("dbshasum", info.ShaSum)
-	}
+	data := uploadVals(c.PrepareVals("", dbName, info.Ident), info)
 
 	// Upload the database
 	var body io.ReadCloser
-	queryUrl := c.Server + "/v1/upload"
-	body, err = sendUpload(queryUrl, c.VerifyServerCert, &data, dbBytes)
-	if body != nil {
-		defer body.Close()
-	}
+	body, err = c.sendUpload(ctx, "/v1/upload", data, dbBytes)
 	if err != nil {
-		if body != nil {
-			// If there's useful error info in the returned JSON, return that as the error message
-			var z JSONError
-			err = json.NewDecoder(body).Decode(&z)
-			if err != nil {
-				return
-			}
-			err = fmt.Errorf("%s", z.Msg)
-		}
+		return
 	}
+	body.Close()
 	return
 }
 
 // UploadLive uploads a new Live database
 func (c Connection) UploadLive(dbName string, dbBytes *[]byte) (err error) {
+	return c.UploadLiveContext(context.Background(), dbName, dbBytes)
+}
+
+// UploadLiveContext is like UploadLive, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) UploadLiveContext(ctx context.Context, dbName string, dbBytes *[]byte) (err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals("", dbName, Identifier{})
 	data.Del("dbowner") // The upload function always stores the database in the account of the API key user
@@ -418,32 +517,25 @@ func (c Connection) UploadLive(dbName string, dbBytes *[]byte) (err error) {
 
 	// Upload the database
 	var body io.ReadCloser
-	queryUrl := c.Server + "/v1/upload"
-	body, err = sendUpload(queryUrl, c.VerifyServerCert, &data, dbBytes)
-	if body != nil {
-		defer body.Close()
-	}
+	body, err = c.sendUpload(ctx, "/v1/upload", data, dbBytes)
 	if err != nil {
-		if body != nil {
-			// If there's useful error info in the returned JSON, return that as the error message
-			var z JSONError
-			err = json.NewDecoder(body).Decode(&z)
-			if err != nil {
-				return
-			}
-			err = fmt.Errorf("%s", z.Msg)
-		}
+		return
 	}
+	body.Close()
 	return
 }
 
 // Webpage returns the URL of the database file in the webUI.  eg. for web browsers
 func (c Connection) Webpage(dbOwner, dbName string) (webPage WebpageResponseContainer, err error) {
+	return c.WebpageContext(context.Background(), dbOwner, dbName)
+}
+
+// WebpageContext is like Webpage, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) WebpageContext(ctx context.Context, dbOwner, dbName string) (webPage WebpageResponseContainer, err error) {
 	// Prepare the API parameters
 	data := c.PrepareVals(dbOwner, dbName, Identifier{})
 
 	// Fetch the releases
-	queryUrl := c.Server + "/v1/webpage"
-	err = sendRequestJSON(queryUrl, c.VerifyServerCert, data, &webPage)
+	err = c.sendRequestJSON(ctx, "/v1/webpage", data, &webPage)
 	return
 }
@@ -2,6 +2,7 @@ package dbhub
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"io"
 	"log"
@@ -421,6 +422,20 @@ func TestQuery(t *testing.T) {
 	assert.Contains(t, result.Rows, ResultRow{Fields: []string{"6", "Batty"}})
 }
 
+// TestQueryContextCancelled verifies a cancelled context aborts the request before it reaches the server
+func TestQueryContextCancelled(t *testing.T) {
+	// Create the local test server connection
+	conn := serverConnection("Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw")
+
+	// Cancel the context before the query is sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := conn.QueryContext(ctx, "default", "Join Testing with index.sqlite", Identifier{}, false, "SELECT id FROM table1")
+
+	// Verify the cancellation is what's reported back
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 // TestReleases verifies the Releases API call
 func TestReleases(t *testing.T) {
 	// Create the local test server connection
@@ -590,6 +605,33 @@ func TestUploadLive(t *testing.T) {
 	assert.Empty(t, diffs.Diff)
 }
 
+// TestWithTransport verifies requests are sent through a caller provided transport
+func TestWithTransport(t *testing.T) {
+	// Create a connection which sends its requests through a counting transport
+	rt := &countingTransport{next: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	conn, err := New("Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw", WithTransport(rt))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conn.ChangeServer("https://localhost:9444")
+
+	// Make a couple of requests
+	_, err = conn.Tables("default", "Assembly Election 2017.sqlite", Identifier{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = conn.Views("default", "Assembly Election 2017 with view.sqlite", Identifier{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Verify both requests went through the transport
+	assert.Equal(t, 2, rt.count)
+}
+
 // TestViews verifies the Views API call
 func TestViews(t *testing.T) {
 	// Create the local test server connection
@@ -619,6 +661,17 @@ func TestWebpage(t *testing.T) {
 	assert.Equal(t, "https://docker-dev.dbhub.io:9443/default/Assembly Election 2017.sqlite", pageData.WebPage)
 }
 
+// countingTransport is a http.RoundTripper which counts the requests passing through it
+type countingTransport struct {
+	count int
+	next  http.RoundTripper
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.count++
+	return c.next.RoundTrip(req)
+}
+
 // randomString generates a random alphanumeric string of the desired length
 func randomString(length int) string {
 	rand.Seed(time.Now().UnixNano())
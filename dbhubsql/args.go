@@ -0,0 +1,191 @@
+package dbhubsql
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFormat is the format used for time.Time arguments.  It's understood by the SQLite date and time functions.
+const timeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// interpolate substitutes the arguments into the placeholders of a SQL statement, returning the resulting SQL.  The
+// SQLite placeholder forms ?, ?NNN, :name, @name, and $name are supported.  Placeholder characters inside string
+// literals, quoted identifiers, and comments are left alone.
+func interpolate(query string, args []driver.NamedValue) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	used := make([]bool, len(args))
+	var out strings.Builder
+	highest := 0
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`' || ch == '[':
+			// Copy quoted strings and identifiers as is
+			end := quotedEnd(query, i)
+			out.WriteString(query[i:end])
+			i = end
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+		case ch == '?':
+			// Numbered or anonymous placeholder
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			n := highest + 1
+			if j > i+1 {
+				var err error
+				n, err = strconv.Atoi(query[i+1 : j])
+				if err != nil || n < 1 {
+					return "", fmt.Errorf("invalid placeholder '%s'", query[i:j])
+				}
+			}
+			if n > highest {
+				highest = n
+			}
+			idx := -1
+			for k, a := range args {
+				if a.Name == "" && a.Ordinal == n {
+					idx = k
+				}
+			}
+			if idx < 0 {
+				return "", fmt.Errorf("no argument given for placeholder %d", n)
+			}
+			if err := writeLiteral(&out, args[idx].Value); err != nil {
+				return "", err
+			}
+			used[idx] = true
+			i = j
+		case (ch == ':' || ch == '@' || ch == '$') && i+1 < len(query) && isNameChar(query[i+1]):
+			// Named placeholder
+			j := i + 1
+			for j < len(query) && isNameChar(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			idx := -1
+			for k, a := range args {
+				if a.Name == name {
+					idx = k
+				}
+			}
+			if idx < 0 {
+				return "", fmt.Errorf("no argument given for placeholder '%s'", query[i:j])
+			}
+			if err := writeLiteral(&out, args[idx].Value); err != nil {
+				return "", err
+			}
+			used[idx] = true
+			i = j
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+
+	// Every argument should have been used, otherwise the statement probably isn't what the caller meant
+	for k, u := range used {
+		if !u {
+			if args[k].Name != "" {
+				return "", fmt.Errorf("argument '%s' isn't used in the statement", args[k].Name)
+			}
+			return "", fmt.Errorf("argument %d isn't used in the statement", args[k].Ordinal)
+		}
+	}
+	return out.String(), nil
+}
+
+// quotedEnd returns the position just after the quoted string or identifier starting at position i
+func quotedEnd(query string, i int) int {
+	closing := query[i]
+	if closing == '[' {
+		closing = ']'
+	}
+	for j := i + 1; j < len(query); j++ {
+		if query[j] != closing {
+			continue
+		}
+
+		// Doubled quote characters are escaped quotes, except for [identifiers]
+		if closing != ']' && j+1 < len(query) && query[j+1] == closing {
+			j++
+			continue
+		}
+		return j + 1
+	}
+	return len(query)
+}
+
+// isNameChar returns true for the characters allowed in placeholder names
+func isNameChar(ch byte) bool {
+	return ch == '_' || (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch >= 0x80
+}
+
+// writeLiteral writes a value as a SQLite literal
+func writeLiteral(out *strings.Builder, v driver.Value) error {
+	switch val := v.(type) {
+	case nil:
+		out.WriteString("NULL")
+	case int64:
+		out.WriteString(strconv.FormatInt(val, 10))
+	case float64:
+		switch {
+		case math.IsNaN(val):
+			out.WriteString("NULL")
+		case math.IsInf(val, 1):
+			out.WriteString("9e999")
+		case math.IsInf(val, -1):
+			out.WriteString("-9e999")
+		default:
+			// Make sure whole numbers are still treated as REAL values by SQLite
+			s := strconv.FormatFloat(val, 'g', -1, 64)
+			if !strings.ContainsAny(s, ".e") {
+				s += ".0"
+			}
+			out.WriteString(s)
+		}
+	case bool:
+		if val {
+			out.WriteString("1")
+		} else {
+			out.WriteString("0")
+		}
+	case []byte:
+		out.WriteString("X'")
+		out.WriteString(hex.EncodeToString(val))
+		out.WriteString("'")
+	case string:
+		out.WriteString("'")
+		out.WriteString(strings.ReplaceAll(val, "'", "''"))
+		out.WriteString("'")
+	case time.Time:
+		out.WriteString("'")
+		out.WriteString(val.Format(timeFormat))
+		out.WriteString("'")
+	default:
+		return fmt.Errorf("unsupported argument type %T", v)
+	}
+	return nil
+}
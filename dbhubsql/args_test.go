@@ -0,0 +1,55 @@
+package dbhubsql
+
+import (
+	"database/sql/driver"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestInterpolate verifies arguments are safely substituted into the placeholders of statements
+func TestInterpolate(t *testing.T) {
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		query string
+		args  []driver.NamedValue
+		want  string
+	}{
+		{"SELECT * FROM t WHERE id = ? AND name = ?",
+			[]driver.NamedValue{{Ordinal: 1, Value: int64(5)}, {Ordinal: 2, Value: "O'Brien"}},
+			"SELECT * FROM t WHERE id = 5 AND name = 'O''Brien'"},
+		{"SELECT ?2, ?1, ?",
+			[]driver.NamedValue{{Ordinal: 1, Value: 1.0}, {Ordinal: 2, Value: 2.5}, {Ordinal: 3, Value: nil}},
+			"SELECT 2.5, 1.0, NULL"},
+		{"INSERT INTO t VALUES (:a, @b, $c, :a)",
+			[]driver.NamedValue{{Name: "a", Value: true}, {Name: "b", Value: []byte{0xde, 0xad}}, {Name: "c", Value: when}},
+			"INSERT INTO t VALUES (1, X'dead', '2024-01-02 03:04:05+00:00', 1)"},
+		{"SELECT '?', \"a?\", [b?], `c?`, 'it''s ?' -- comment ?\n, /* ? */ ?",
+			[]driver.NamedValue{{Ordinal: 1, Value: math.Inf(-1)}},
+			"SELECT '?', \"a?\", [b?], `c?`, 'it''s ?' -- comment ?\n, /* ? */ -9e999"},
+		{"SELECT time('now')", nil, "SELECT time('now')"},
+	}
+	for _, test := range tests {
+		got, err := interpolate(test.query, test.args)
+		if assert.NoError(t, err, test.query) {
+			assert.Equal(t, test.want, got)
+		}
+	}
+}
+
+// TestInterpolateErrors verifies mismatched placeholders and arguments are reported
+func TestInterpolateErrors(t *testing.T) {
+	_, err := interpolate("SELECT ?, ?", []driver.NamedValue{{Ordinal: 1, Value: int64(1)}})
+	assert.EqualError(t, err, "no argument given for placeholder 2")
+
+	_, err = interpolate("SELECT ?", []driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: int64(2)}})
+	assert.EqualError(t, err, "argument 2 isn't used in the statement")
+
+	_, err = interpolate("SELECT :a", []driver.NamedValue{{Name: "b", Value: int64(1)}})
+	assert.EqualError(t, err, "no argument given for placeholder ':a'")
+
+	_, err = interpolate("SELECT ?", []driver.NamedValue{{Ordinal: 1, Value: struct{}{}}})
+	assert.EqualError(t, err, "unsupported argument type struct {}")
+}
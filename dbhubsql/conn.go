@@ -0,0 +1,193 @@
+package dbhubsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+// Make sure the optional driver interfaces used by database/sql are implemented
+var (
+	_ driver.QueryerContext                 = (*conn)(nil)
+	_ driver.ExecerContext                  = (*conn)(nil)
+	_ driver.StmtQueryContext               = (*stmt)(nil)
+	_ driver.StmtExecContext                = (*stmt)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*rows)(nil)
+	_ driver.DriverContext                  = (*Driver)(nil)
+)
+
+// errNoTransactions is returned when trying to start a transaction, as the DBHub.io API doesn't support them
+var errNoTransactions = errors.New("transactions aren't supported by DBHub.io databases")
+
+// conn is a connection to a DBHub.io database.  It doesn't hold any server side state, so it's safe to reuse.
+type conn struct {
+	c *Connector
+}
+
+// Prepare returns a prepared statement.  As the DBHub.io API doesn't support prepared statements, the SQL is just kept
+// until the statement is run.
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+// Close closes the connection
+func (c *conn) Close() error {
+	return nil
+}
+
+// Begin returns an error, as transactions aren't supported
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errNoTransactions
+}
+
+// QueryContext runs a query using the DBHub.io query end point
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query, err := interpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	results, err := c.c.conn.QueryTypedContext(ctx, c.c.owner, c.c.name, c.c.ident, query)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{results: results}, nil
+}
+
+// ExecContext runs a statement using the DBHub.io execute end point.  This only works for Live databases.
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query, err := interpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := c.c.conn.ExecuteContext(ctx, c.c.owner, c.c.name, query)
+	if err != nil {
+		return nil, err
+	}
+	return result(changed), nil
+}
+
+// stmt is a statement waiting to be run
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+// Close closes the statement
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1, as the number of placeholders in the statement is only checked when it's run
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+// Exec runs the statement
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+// ExecContext runs the statement
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+// Query runs the statement as a query
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+// QueryContext runs the statement as a query
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+// result holds the number of rows changed by a statement
+type result int
+
+// LastInsertId returns an error, as the DBHub.io API doesn't return the id of inserted rows
+func (r result) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId isn't supported by DBHub.io databases")
+}
+
+// RowsAffected returns the number of rows changed by the statement
+func (r result) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+// rows holds the results of a query.  The DBHub.io API returns all of the rows at once, so they're already in memory.
+type rows struct {
+	results dbhub.TypedResults
+	pos     int
+}
+
+// Columns returns the names of the result columns
+func (r *rows) Columns() []string {
+	names := make([]string, len(r.results.Columns))
+	for i, col := range r.results.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// Close closes the rows
+func (r *rows) Close() error {
+	return nil
+}
+
+// Next copies the next row of values into dest
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.results.Rows) {
+		return io.EOF
+	}
+	for i, v := range r.results.Rows[r.pos] {
+		dest[i] = v
+	}
+	r.pos++
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName returns the SQLite storage class of the column.  As SQLite columns can hold values of any
+// type, this is the type of the first non NULL value in the column, or an empty string if they're all NULL.
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	switch r.results.Columns[index].Type {
+	case dbhub.Integer:
+		return "INTEGER"
+	case dbhub.Float:
+		return "REAL"
+	case dbhub.Text:
+		return "TEXT"
+	case dbhub.Binary, dbhub.Image:
+		return "BLOB"
+	}
+	return ""
+}
+
+// ColumnTypeScanType returns the Go type of the values in the column
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	switch r.results.Columns[index].Type {
+	case dbhub.Integer:
+		return reflect.TypeOf(int64(0))
+	case dbhub.Float:
+		return reflect.TypeOf(float64(0))
+	case dbhub.Text:
+		return reflect.TypeOf("")
+	case dbhub.Binary, dbhub.Image:
+		return reflect.TypeOf([]byte(nil))
+	}
+	return reflect.TypeOf((*interface{})(nil)).Elem()
+}
+
+// namedValues converts the arguments of the older driver interfaces into named values
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
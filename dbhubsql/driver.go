@@ -0,0 +1,118 @@
+// Package dbhubsql provides a database/sql driver for databases stored on DBHub.io.
+//
+// The driver is registered with the name "dbhub", and takes data source names in this form:
+//
+//	dbhub://APIKEY@api.dbhub.io/owner/database.sqlite?branch=main
+//
+// One of the branch, commit, tag, or release parameters can be given to choose the database version queried.  Setting
+// verifycert=false disables verification of the server https certificate, and using the dbhub+http:// scheme instead
+// talks to the server using plain http.  Both of these are only meant for testing and development.
+//
+// Queries are run using the DBHub.io query end point, and other statements are run using the execute end point (Live
+// databases only).  As the server doesn't support placeholders, any arguments are safely quoted and substituted into
+// the SQL by the driver before it's sent.  Transactions aren't supported.
+package dbhubsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+func init() {
+	sql.Register("dbhub", &Driver{})
+}
+
+// Driver is the database/sql driver for DBHub.io databases
+type Driver struct{}
+
+// Open returns a new connection to the database named by the data source name
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector parses the data source name, returning a connector for the database it names
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data source name: %w", err)
+	}
+
+	// Work out the server address
+	var server string
+	switch u.Scheme {
+	case "dbhub":
+		server = "https://" + u.Host
+	case "dbhub+http":
+		server = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("unknown data source name scheme '%s'", u.Scheme)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("data source name doesn't include an API key")
+	}
+
+	// The path holds the database owner and name
+	owner, name, ok := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if !ok || owner == "" || name == "" {
+		return nil, fmt.Errorf("data source name path should be /owner/database, not '%s'", u.Path)
+	}
+
+	// Optional parameters
+	q := u.Query()
+	ident := dbhub.Identifier{
+		Branch:   q.Get("branch"),
+		CommitID: q.Get("commit"),
+		Release:  q.Get("release"),
+		Tag:      q.Get("tag"),
+	}
+	conn, err := dbhub.New(u.User.Username())
+	if err != nil {
+		return nil, err
+	}
+	conn.ChangeServer(server)
+	if v := q.Get("verifycert"); v != "" {
+		verify, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verifycert value '%s'", v)
+		}
+		conn.ChangeVerifyServerCert(verify)
+	}
+	return &Connector{conn: conn, owner: owner, name: name, ident: ident, driver: d}, nil
+}
+
+// Connector holds the details needed to query a DBHub.io database
+type Connector struct {
+	conn   dbhub.Connection
+	owner  string
+	name   string
+	ident  dbhub.Identifier
+	driver driver.Driver
+}
+
+// NewConnector returns a connector for the given database, which sends its requests using an existing connection.
+// This allows using connection options (eg retries) which can't be given in a data source name.  Use it with
+// sql.OpenDB().
+func NewConnector(conn dbhub.Connection, dbOwner, dbName string, ident dbhub.Identifier) *Connector {
+	return &Connector{conn: conn, owner: dbOwner, name: dbName, ident: ident, driver: &Driver{}}
+}
+
+// Connect returns a connection to the database.  No request is sent to DBHub.io until a statement is run.
+func (c *Connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{c: c}, nil
+}
+
+// Driver returns the underlying driver of the connector
+func (c *Connector) Driver() driver.Driver {
+	return c.driver
+}
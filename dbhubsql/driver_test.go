@@ -0,0 +1,105 @@
+package dbhubsql
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testServer creates a server which records the SQL sent to it, and returns canned results
+func testServer(t *testing.T, sent *[]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sqlText, _ := base64.StdEncoding.DecodeString(r.FormValue("sql"))
+		*sent = append(*sent, r.URL.Path+" "+r.FormValue("dbowner")+"/"+r.FormValue("dbname")+"@"+
+			r.FormValue("branch")+" "+string(sqlText))
+		switch r.URL.Path {
+		case "/v1/query":
+			w.Write([]byte(`[
+				[{"Name":"id","Type":4,"Value":1},{"Name":"name","Type":3,"Value":"Foo"},{"Name":"data","Type":2,"Value":null}],
+				[{"Name":"id","Type":4,"Value":2},{"Name":"name","Type":3,"Value":"Bar"},{"Name":"data","Type":0,"Value":"xyz"}]
+			]`))
+		case "/v1/execute":
+			w.Write([]byte(`{"rows_changed":3,"status":"OK"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestDriver verifies queries and statements run through database/sql reach the right API end points
+func TestDriver(t *testing.T) {
+	var sent []string
+	srv := testServer(t, &sent)
+	dsn := "dbhub+http://somekey@" + strings.TrimPrefix(srv.URL, "http://") + "/default/Join%20Testing.sqlite?branch=main"
+	db, err := sql.Open("dbhub", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Run a query
+	rows, err := db.Query("SELECT id, name, data FROM table1 WHERE id > ?", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, err := rows.ColumnTypes()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "INTEGER", types[0].DatabaseTypeName())
+		assert.Equal(t, "TEXT", types[1].DatabaseTypeName())
+		assert.Equal(t, "BLOB", types[2].DatabaseTypeName())
+	}
+	type row struct {
+		id   int
+		name string
+		data []byte
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		assert.NoError(t, rows.Scan(&r.id, &r.name, &r.data))
+		got = append(got, r)
+	}
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, []row{{1, "Foo", nil}, {2, "Bar", []byte("xyz")}}, got)
+
+	// Run a statement
+	res, err := db.Exec("UPDATE table1 SET name = :name", sql.Named("name", "Baz"))
+	if assert.NoError(t, err) {
+		n, err := res.RowsAffected()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+	}
+
+	// Verify what was sent to the server
+	assert.Equal(t, []string{
+		"/v1/query default/Join Testing.sqlite@main SELECT id, name, data FROM table1 WHERE id > 0",
+		"/v1/execute default/Join Testing.sqlite@ UPDATE table1 SET name = 'Baz'",
+	}, sent)
+
+	// Transactions aren't supported
+	_, err = db.Begin()
+	assert.Error(t, err)
+}
+
+// TestDataSourceNames verifies invalid data source names are rejected
+func TestDataSourceNames(t *testing.T) {
+	d := &Driver{}
+	for _, dsn := range []string{
+		"postgres://key@api.dbhub.io/default/db.sqlite",
+		"dbhub://api.dbhub.io/default/db.sqlite",
+		"dbhub://key@api.dbhub.io/db.sqlite",
+		"dbhub://key@api.dbhub.io/default/db.sqlite?verifycert=maybe",
+	} {
+		_, err := d.OpenConnector(dsn)
+		assert.Error(t, err, dsn)
+	}
+	_, err := d.OpenConnector("dbhub://key@api.dbhub.io/default/db.sqlite?tag=v1&verifycert=false")
+	assert.NoError(t, err)
+}
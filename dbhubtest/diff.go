@@ -0,0 +1,316 @@
+package dbhubtest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+// schemaObject is a table, view, index, or trigger in a database
+type schemaObject struct {
+	objType string
+	sql     string
+}
+
+// tableRow is a row of a table, along with the values of its primary key
+type tableRow struct {
+	pk     []dbhub.DataValue
+	values []interface{}
+}
+
+// diffDBs compares two database files, returning the changes needed to turn the first into the second.  This is a
+// simplified version of the diff done by the DBHub.io server, which is good enough for testing.
+func diffDBs(pathA, pathB string, merge dbhub.MergeStrategy) (diffs dbhub.Diffs, err error) {
+	dbA, err := openDB(pathA, false)
+	if err != nil {
+		return
+	}
+	defer dbA.Close()
+	dbB, err := openDB(pathB, false)
+	if err != nil {
+		return
+	}
+	defer dbB.Close()
+
+	objectsA, err := schemaObjects(dbA)
+	if err != nil {
+		return
+	}
+	objectsB, err := schemaObjects(dbB)
+	if err != nil {
+		return
+	}
+
+	// Process the objects in name order, so the results are always the same
+	names := make([]string, 0, len(objectsA)+len(objectsB))
+	for name := range objectsA {
+		names = append(names, name)
+	}
+	for name := range objectsB {
+		if _, ok := objectsA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs.Diff = []dbhub.DiffObjectChangeset{}
+	for _, name := range names {
+		a, inA := objectsA[name]
+		b, inB := objectsB[name]
+		change := dbhub.DiffObjectChangeset{ObjectName: name}
+		switch {
+		case !inA:
+			// The object was added.  For tables all of their rows are new too
+			change.ObjectType = b.objType
+			change.Schema = &dbhub.SchemaDiff{ActionType: dbhub.ActionAdd, After: b.sql}
+			if merge != dbhub.NoMerge {
+				change.Schema.Sql = b.sql + ";"
+			}
+			if b.objType == "table" {
+				change.Data, err = diffTable(nil, dbB, name, merge)
+				if err != nil {
+					return
+				}
+			}
+		case !inB:
+			change.ObjectType = a.objType
+			change.Schema = &dbhub.SchemaDiff{ActionType: dbhub.ActionDelete, Before: a.sql}
+			if merge != dbhub.NoMerge {
+				change.Schema.Sql = fmt.Sprintf("DROP %s %s;", strings.ToUpper(a.objType), quoteIdent(name))
+			}
+		case a.sql != b.sql:
+			change.ObjectType = b.objType
+			change.Schema = &dbhub.SchemaDiff{ActionType: dbhub.ActionModify, Before: a.sql, After: b.sql}
+			if merge != dbhub.NoMerge {
+				change.Schema.Sql = fmt.Sprintf("DROP %s %s;%s;", strings.ToUpper(a.objType), quoteIdent(name), b.sql)
+			}
+		default:
+			// The schema is unchanged, so only the data of tables can be different
+			if a.objType != "table" {
+				continue
+			}
+			change.ObjectType = a.objType
+			change.Data, err = diffTable(dbA, dbB, name, merge)
+			if err != nil {
+				return
+			}
+			if len(change.Data) == 0 {
+				continue
+			}
+		}
+		diffs.Diff = append(diffs.Diff, change)
+	}
+	return
+}
+
+// schemaObjects returns the user created objects in a database, keyed by name
+func schemaObjects(sdb *sqlite.Conn) (map[string]schemaObject, error) {
+	stmt, err := sdb.Prepare("SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Finalize()
+	objects := make(map[string]schemaObject)
+	err = stmt.Select(func(s *sqlite.Stmt) error {
+		var o schemaObject
+		var name string
+		if err := s.Scan(&o.objType, &name, &o.sql); err != nil {
+			return err
+		}
+		objects[name] = o
+		return nil
+	})
+	return objects, err
+}
+
+// diffTable compares the rows of a table in two databases.  Rows are matched up using the primary key of the table,
+// or the rowid if it doesn't have one.  When dbA is nil, all of the rows in dbB are treated as new.
+func diffTable(dbA, dbB *sqlite.Conn, table string, merge dbhub.MergeStrategy) (changes []dbhub.DataDiff, err error) {
+	cols, err := dbB.Columns("", table)
+	if err != nil {
+		return
+	}
+	var colNames []string
+	var pkCols []sqlite.Column
+	for _, c := range cols {
+		colNames = append(colNames, c.Name)
+		if c.Pk > 0 {
+			pkCols = append(pkCols, c)
+		}
+	}
+	sort.Slice(pkCols, func(i, j int) bool { return pkCols[i].Pk < pkCols[j].Pk })
+
+	// An INTEGER PRIMARY KEY column is an alias for the rowid, so when merging with new primary keys it's left out of
+	// the INSERT statements for the database to fill in
+	autoPk := len(pkCols) == 1 && strings.EqualFold(pkCols[0].DataType, "integer")
+
+	rowsA := []tableRow{}
+	if dbA != nil {
+		rowsA, err = readRows(dbA, table, pkCols)
+		if err != nil {
+			return
+		}
+	}
+	rowsB, err := readRows(dbB, table, pkCols)
+	if err != nil {
+		return
+	}
+
+	inB := make(map[string]tableRow, len(rowsB))
+	for _, r := range rowsB {
+		inB[rowKey(r.pk)] = r
+	}
+	inA := make(map[string]bool, len(rowsA))
+	for _, a := range rowsA {
+		key := rowKey(a.pk)
+		inA[key] = true
+		b, ok := inB[key]
+		if !ok {
+			d := dbhub.DataDiff{ActionType: dbhub.ActionDelete, Pk: a.pk, DataBefore: a.values}
+			if merge != dbhub.NoMerge {
+				d.Sql = fmt.Sprintf("DELETE FROM %s WHERE %s;", quoteIdent(table), pkCondition(a.pk))
+			}
+			changes = append(changes, d)
+			continue
+		}
+		if rowKey(valuesAsData(a.values)) == rowKey(valuesAsData(b.values)) {
+			continue
+		}
+		d := dbhub.DataDiff{ActionType: dbhub.ActionModify, Pk: a.pk, DataBefore: a.values, DataAfter: b.values}
+		if merge != dbhub.NoMerge {
+			var set []string
+			for i, name := range colNames {
+				if literal(a.values[i]) != literal(b.values[i]) {
+					set = append(set, quoteIdent(name)+"="+literal(b.values[i]))
+				}
+			}
+			d.Sql = fmt.Sprintf("UPDATE %s SET %s WHERE %s;", quoteIdent(table), strings.Join(set, ","),
+				pkCondition(a.pk))
+		}
+		changes = append(changes, d)
+	}
+	for _, b := range rowsB {
+		if inA[rowKey(b.pk)] {
+			continue
+		}
+		d := dbhub.DataDiff{ActionType: dbhub.ActionAdd, Pk: b.pk, DataAfter: b.values}
+		if merge != dbhub.NoMerge {
+			var names, values []string
+			for i, name := range colNames {
+				if merge == dbhub.NewPkMerge && autoPk && name == pkCols[0].Name {
+					continue
+				}
+				names = append(names, quoteIdent(name))
+				values = append(values, literal(b.values[i]))
+			}
+			d.Sql = fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s);", quoteIdent(table), strings.Join(names, ","),
+				strings.Join(values, ","))
+		}
+		changes = append(changes, d)
+	}
+	return
+}
+
+// readRows reads all of the rows in a table, in primary key order
+func readRows(sdb *sqlite.Conn, table string, pkCols []sqlite.Column) (rows []tableRow, err error) {
+	// Tables without a primary key use the rowid, which is selected as an extra first column
+	query := "SELECT _rowid_, * FROM " + quoteIdent(table) + " ORDER BY _rowid_"
+	if len(pkCols) > 0 {
+		var order []string
+		for _, c := range pkCols {
+			order = append(order, quoteIdent(c.Name))
+		}
+		query = "SELECT * FROM " + quoteIdent(table) + " ORDER BY " + strings.Join(order, ",")
+	}
+	stmt, err := sdb.Prepare(query)
+	if err != nil {
+		return
+	}
+	defer stmt.Finalize()
+	err = stmt.Select(func(s *sqlite.Stmt) error {
+		var r tableRow
+		start := 0
+		if len(pkCols) == 0 {
+			v, t := dataValue(s, 0)
+			r.pk = []dbhub.DataValue{{Name: "_rowid_", Type: t, Value: v}}
+			start = 1
+		}
+		for i := start; i < s.ColumnCount(); i++ {
+			v, _ := dataValue(s, i)
+			r.values = append(r.values, v)
+		}
+		for _, c := range pkCols {
+			v, t := dataValue(s, c.Cid+start)
+			r.pk = append(r.pk, dbhub.DataValue{Name: c.Name, Type: t, Value: v})
+		}
+		rows = append(rows, r)
+		return nil
+	})
+	return
+}
+
+// valuesAsData wraps row values so they can be compared using rowKey
+func valuesAsData(values []interface{}) []dbhub.DataValue {
+	d := make([]dbhub.DataValue, len(values))
+	for i, v := range values {
+		d[i].Value = v
+	}
+	return d
+}
+
+// rowKey returns a string uniquely identifying a list of values
+func rowKey(values []dbhub.DataValue) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = literal(v.Value)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// pkCondition returns the WHERE clause condition matching a primary key
+func pkCondition(pk []dbhub.DataValue) string {
+	parts := make([]string, len(pk))
+	for i, v := range pk {
+		parts[i] = quoteIdent(v.Name) + "=" + literal(v.Value)
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// quoteIdent quotes an SQL identifier
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// literal formats a value as an SQL literal.  Binary values are held as strings by dataValue, so any string which
+// isn't valid text is written as a blob.
+func literal(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		s := strconv.FormatFloat(val, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	case string:
+		if !isText(val) {
+			return "X'" + hex.EncodeToString([]byte(val)) + "'"
+		}
+		return "'" + strings.ReplaceAll(val, "'", "''") + "'"
+	}
+	return fmt.Sprintf("'%v'", v)
+}
+
+// isText returns whether a string is valid UTF-8 without any NUL characters
+func isText(s string) bool {
+	return !strings.ContainsRune(s, 0) && utf8.ValidString(s)
+}
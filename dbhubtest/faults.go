@@ -0,0 +1,186 @@
+package dbhubtest
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+// Fault describes bad behaviour for the server to show when handling a request.  The zero Fault handles the request
+// normally.
+type Fault struct {
+	// Delay is how long to wait before handling the request
+	Delay time.Duration
+
+	// Status, when non-zero, makes the server respond with this status code instead of handling the request.  The
+	// response body is Body, or a JSON error message in the format used by DBHub.io if Body is empty.
+	Status int
+	Body   string
+
+	// ContentType is the Content-Type of Body.  It defaults to text/html for bodies starting with "<", otherwise
+	// application/json.
+	ContentType string
+
+	// RetryAfter sets the Retry-After header of the response, eg "2" or an http date
+	RetryAfter string
+
+	// ResponseDelay is how long to wait after handling the request, before sending the response.  Combined with a
+	// client side timeout, this gives requests which succeed on the server but fail on the client.
+	ResponseDelay time.Duration
+
+	// Truncate, when greater than zero, cuts the response body off after this many bytes.  The Content-Length header
+	// still gives the full size, so the client sees the connection close part way through the body.
+	Truncate int
+
+	// IgnoreRange makes the server ignore any Range header in the request, like servers and proxies which don't
+	// support range requests
+	IgnoreRange bool
+}
+
+// RateLimited returns a fault responding with status 429, asking the client to wait for retryAfter (rounded up to a
+// whole second) before trying again
+func RateLimited(retryAfter time.Duration) Fault {
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	return Fault{Status: http.StatusTooManyRequests, RetryAfter: strconv.Itoa(secs)}
+}
+
+// HTMLError returns a fault responding with an HTML error page instead of JSON, like the ones sent by proxies and
+// load balancers
+func HTMLError(status int) Fault {
+	text := strconv.Itoa(status) + " " + http.StatusText(status)
+	return Fault{Status: status, Body: "<html><head><title>" + text + "</title></head><body><center><h1>" + text +
+		"</h1></center><hr><center>nginx</center></body></html>\n"}
+}
+
+// Script sets the faults for the next calls to an end point, one fault per call in order.  A zero Fault in the list
+// lets its call through normally.  Once the script runs out, calls go back to using the fault given to SetFault (if
+// any).  Calling Script again replaces any remaining faults from the previous script for the end point.
+//
+//	// Fail the next call to the query end point with a 503, then make the one after that wait for a second
+//	srv.Script("/v1/query", dbhubtest.Fault{Status: http.StatusServiceUnavailable}, dbhubtest.Fault{Delay: time.Second})
+func (s *Server) Script(endpoint string, faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[endpoint] = append([]Fault(nil), faults...)
+}
+
+// SetFault sets a fault applied to every call to an end point which isn't covered by a script.  Setting the zero
+// Fault removes it.
+func (s *Server) SetFault(endpoint string, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f == (Fault{}) {
+		delete(s.faults, endpoint)
+		return
+	}
+	s.faults[endpoint] = f
+}
+
+// ClearFaults removes all of the faults and scripts set on the server
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]Fault)
+	s.scripts = make(map[string][]Fault)
+}
+
+// Calls returns the number of requests an end point has received, including ones which were given a fault
+func (s *Server) Calls(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[endpoint]
+}
+
+// nextFault counts a call to an end point, returning the fault to apply to it
+func (s *Server) nextFault(endpoint string) Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[endpoint]++
+	if script := s.scripts[endpoint]; len(script) > 0 {
+		s.scripts[endpoint] = script[1:]
+		return script[0]
+	}
+	return s.faults[endpoint]
+}
+
+// injectFaults applies the faults set for an end point to its requests.  The server lock isn't held while waiting, so
+// slow requests don't hold up others.
+func (s *Server) injectFaults(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := s.nextFault(endpoint)
+		if !wait(r.Context(), f.Delay) {
+			return
+		}
+		if f.IgnoreRange {
+			r.Header.Del("Range")
+		}
+		if f.Status == 0 && f.RetryAfter == "" && f.ResponseDelay == 0 && f.Truncate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Capture the response, so it can be changed before being sent
+		rec := httptest.NewRecorder()
+		if f.Status != 0 {
+			f.writeResponse(rec)
+		} else {
+			next.ServeHTTP(rec, r)
+		}
+		if !wait(r.Context(), f.ResponseDelay) {
+			return
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		if f.RetryAfter != "" {
+			w.Header().Set("Retry-After", f.RetryAfter)
+		}
+		body := rec.Body.Bytes()
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if f.Truncate > 0 && f.Truncate < len(body) {
+			body = body[:f.Truncate]
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(body)
+	})
+}
+
+// writeResponse sends the error response of a fault
+func (f Fault) writeResponse(w http.ResponseWriter) {
+	body, contentType := f.Body, f.ContentType
+	if body == "" {
+		data, _ := json.Marshal(dbhub.JSONError{Msg: http.StatusText(f.Status)})
+		body = string(data)
+	}
+	if contentType == "" {
+		contentType = "application/json"
+		if strings.HasPrefix(body, "<") {
+			contentType = "text/html; charset=utf-8"
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(f.Status)
+	w.Write([]byte(body))
+}
+
+// wait pauses for the given duration, returning false if the client gave up on the request in the meantime
+func wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
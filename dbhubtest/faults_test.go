@@ -0,0 +1,151 @@
+package dbhubtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastRetries is a retry policy which doesn't slow the tests down
+var fastRetries = dbhub.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+// TestErrorMessages verifies the error message in JSON error responses is passed on to the caller
+func TestErrorMessages(t *testing.T) {
+	srv, conn, _, _ := newTestServer(t)
+
+	srv.Script("/v1/tables", Fault{Status: http.StatusInternalServerError, Body: `{"error":"Something broke"}`},
+		Fault{Status: http.StatusNotFound})
+	_, err := conn.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	var apiErr *dbhub.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+	assert.Equal(t, "/v1/tables", apiErr.Endpoint)
+	assert.Equal(t, "Something broke", err.Error())
+
+	_, err = conn.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	assert.True(t, errors.Is(err, dbhub.ErrNotFound))
+	assert.Equal(t, "Not Found", err.Error())
+
+	// The script has run out, so things are back to normal
+	_, err = conn.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, srv.Calls("/v1/tables"))
+}
+
+// TestHTMLErrorPage verifies error responses which aren't JSON are reported using the http status
+func TestHTMLErrorPage(t *testing.T) {
+	srv, conn, _, _ := newTestServer(t)
+
+	srv.SetFault("/v1/query", HTMLError(http.StatusBadGateway))
+	_, err := conn.Query(DefaultUser, "test.sqlite", dbhub.Identifier{}, false, "SELECT 1")
+	var apiErr *dbhub.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "502 Bad Gateway", err.Error())
+	assert.Empty(t, apiErr.Msg)
+	assert.Contains(t, string(apiErr.Body), "<h1>502 Bad Gateway</h1>")
+
+	srv.SetFault("/v1/query", Fault{})
+	_, err = conn.Query(DefaultUser, "test.sqlite", dbhub.Identifier{}, false, "SELECT 1")
+	assert.NoError(t, err)
+}
+
+// TestRetries verifies transient failures are retried, and other failures aren't
+func TestRetries(t *testing.T) {
+	srv, _, _, _ := newTestServer(t)
+	conn, err := srv.Connection(DefaultAPIKey, dbhub.WithRetryPolicy(fastRetries))
+	require.NoError(t, err)
+
+	srv.Script("/v1/tables", Fault{Status: http.StatusServiceUnavailable}, HTMLError(http.StatusGatewayTimeout))
+	tbls, err := conn.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"people"}, tbls)
+	assert.Equal(t, 3, srv.Calls("/v1/tables"))
+
+	// The delay asked for by the server takes precedence over the retry policy, up to the policy's MaxBackoff
+	patient := fastRetries
+	patient.MaxBackoff = 2 * time.Second
+	patientConn, err := srv.Connection(DefaultAPIKey, dbhub.WithRetryPolicy(patient))
+	require.NoError(t, err)
+	srv.Script("/v1/views", RateLimited(time.Second))
+	start := time.Now()
+	_, err = patientConn.Views(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, 2, srv.Calls("/v1/views"))
+
+	// Longer delays aren't waited for
+	srv.Script("/v1/views", RateLimited(time.Second))
+	_, err = conn.Views(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	assert.True(t, errors.Is(err, dbhub.ErrRateLimited), "unexpected error: %v", err)
+	assert.Equal(t, 3, srv.Calls("/v1/views"))
+
+	// Status 500 isn't retried
+	srv.Script("/v1/indexes", Fault{Status: http.StatusInternalServerError})
+	_, err = conn.Indexes(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	assert.Error(t, err)
+	assert.Equal(t, 1, srv.Calls("/v1/indexes"))
+
+	// Neither are requests which always fail, once the attempts run out
+	srv.SetFault("/v1/columns", Fault{Status: http.StatusServiceUnavailable})
+	_, err = conn.Columns(DefaultUser, "test.sqlite", dbhub.Identifier{}, "people")
+	assert.Error(t, err)
+	assert.Equal(t, fastRetries.MaxAttempts, srv.Calls("/v1/columns"))
+}
+
+// TestTruncatedBody verifies responses cut off part way through are reported as errors
+func TestTruncatedBody(t *testing.T) {
+	srv, conn, _, _ := newTestServer(t)
+
+	srv.Script("/v1/tables", Fault{Truncate: 5})
+	_, err := conn.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "unexpected error: %v", err)
+
+	srv.Script("/v1/download", Fault{Truncate: 100})
+	body, err := conn.Download(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	require.NoError(t, err)
+	defer body.Close()
+	_, err = io.ReadAll(body)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "unexpected error: %v", err)
+}
+
+// TestLatency verifies slow responses are abandoned when the context deadline passes
+func TestLatency(t *testing.T) {
+	srv, conn, _, _ := newTestServer(t)
+
+	srv.SetFault("/v1/tables", Fault{Delay: 200 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := conn.TablesContext(ctx, DefaultUser, "test.sqlite", dbhub.Identifier{})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+
+	// Without a deadline the request is just slow
+	_, err = conn.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	assert.NoError(t, err)
+}
+
+// TestUploadTimeout verifies an upload which succeeds on the server, but times out on the client, isn't retried
+func TestUploadTimeout(t *testing.T) {
+	srv, _, _, _ := newTestServer(t)
+	conn, err := srv.Connection(DefaultAPIKey, dbhub.WithRetryPolicy(fastRetries))
+	require.NoError(t, err)
+
+	srv.Script("/v1/upload", Fault{ResponseDelay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	dbBytes := newDB(t, "CREATE TABLE t (a)")
+	err = conn.UploadContext(ctx, "timeout.sqlite", dbhub.UploadInformation{}, &dbBytes)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	assert.Equal(t, 1, srv.Calls("/v1/upload"))
+
+	// The database was stored anyway
+	dbs, err := conn.Databases()
+	require.NoError(t, err)
+	assert.Contains(t, dbs, "timeout.sqlite")
+}
@@ -0,0 +1,484 @@
+package dbhubtest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+// identFromForm returns the database identifier given in a request.  The suffix is used by the diff end point, which
+// takes identifiers for two databases.
+func identFromForm(r *http.Request, suffix string) dbhub.Identifier {
+	return dbhub.Identifier{
+		Branch:   r.PostFormValue("branch" + suffix),
+		CommitID: r.PostFormValue("commit" + suffix),
+		Release:  r.PostFormValue("release" + suffix),
+		Tag:      r.PostFormValue("tag" + suffix),
+	}
+}
+
+// requestDB returns the database named in a request
+func (s *Server) requestDB(r *http.Request, user string) (*database, error) {
+	name := r.PostFormValue("dbname")
+	if name == "" {
+		return nil, errorf(http.StatusBadRequest, "Missing database name")
+	}
+	return s.lookup(user, r.PostFormValue("dbowner"), name)
+}
+
+// requestPath returns the path of the database file version named in a request
+func (s *Server) requestPath(r *http.Request, user string) (string, error) {
+	db, err := s.requestDB(r, user)
+	if err != nil {
+		return "", err
+	}
+	path, _, err := s.path(db, identFromForm(r, ""))
+	return path, err
+}
+
+// requestStandardDB returns the database named in a request, which must be a standard (not Live) database
+func (s *Server) requestStandardDB(r *http.Request, user string) (*database, error) {
+	db, err := s.requestDB(r, user)
+	if err != nil {
+		return nil, err
+	}
+	if db.live {
+		return nil, errorf(http.StatusBadRequest, "Live databases don't have commits, branches, tags, or releases")
+	}
+	return db, nil
+}
+
+func (s *Server) handleBranches(w http.ResponseWriter, r *http.Request, user string) error {
+	db, err := s.requestStandardDB(r, user)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, dbhub.BranchListResponseContainer{Branches: db.branches,
+		DefaultBranch: db.defaultBranch})
+}
+
+func (s *Server) handleColumns(w http.ResponseWriter, r *http.Request, user string) error {
+	path, err := s.requestPath(r, user)
+	if err != nil {
+		return err
+	}
+	table := r.PostFormValue("table")
+	if table == "" {
+		return errorf(http.StatusBadRequest, "Missing table name")
+	}
+	cols, err := columns(path, table)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, cols)
+}
+
+func (s *Server) handleCommits(w http.ResponseWriter, r *http.Request, user string) error {
+	db, err := s.requestStandardDB(r, user)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, db.commits)
+}
+
+func (s *Server) handleDatabases(w http.ResponseWriter, r *http.Request, user string) error {
+	live := r.PostFormValue("live") == "true"
+	names := []string{}
+	for _, key := range sortedKeys(s.dbs) {
+		db := s.dbs[key]
+		if strings.EqualFold(db.owner, user) && db.live == live {
+			names = append(names, db.name)
+		}
+	}
+	return writeJSON(w, http.StatusOK, names)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request, user string) error {
+	name := r.PostFormValue("dbname")
+	db, err := s.lookup(user, user, name)
+	if err != nil {
+		return err
+	}
+	delete(s.dbs, dbKey(db.owner, db.name))
+	if db.live {
+		os.Remove(db.liveFile)
+	}
+	return writeJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
+
+func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request, user string) error {
+	// Work out the two database versions to compare.  If the second database isn't given, it's the same as the first
+	ownerA, nameA := r.PostFormValue("dbowner_a"), r.PostFormValue("dbname_a")
+	ownerB, nameB := r.PostFormValue("dbowner_b"), r.PostFormValue("dbname_b")
+	if ownerB == "" && nameB == "" {
+		ownerB, nameB = ownerA, nameA
+	}
+	dbA, err := s.lookup(user, ownerA, nameA)
+	if err != nil {
+		return err
+	}
+	dbB, err := s.lookup(user, ownerB, nameB)
+	if err != nil {
+		return err
+	}
+	pathA, _, err := s.path(dbA, identFromForm(r, "_a"))
+	if err != nil {
+		return err
+	}
+	pathB, _, err := s.path(dbB, identFromForm(r, "_b"))
+	if err != nil {
+		return err
+	}
+
+	var merge dbhub.MergeStrategy
+	switch r.PostFormValue("merge") {
+	case "preserve_pk":
+		merge = dbhub.PreservePkMerge
+	case "new_pk":
+		merge = dbhub.NewPkMerge
+	}
+	diffs, err := diffDBs(pathA, pathB, merge)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, diffs)
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request, user string) error {
+	db, err := s.requestDB(r, user)
+	if err != nil {
+		return err
+	}
+	path, _, err := s.path(db, identFromForm(r, ""))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Range requests are supported, so interrupted downloads can be resumed
+	w.Header().Set("Content-Type", "application/x-sqlite3")
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(db.name))
+	http.ServeContent(w, r, db.name, time.Time{}, f)
+	return nil
+}
+
+func (s *Server) handleExecute(w http.ResponseWriter, r *http.Request, user string) error {
+	db, err := s.requestDB(r, user)
+	if err != nil {
+		return err
+	}
+	if !db.live {
+		return errorf(http.StatusBadRequest, "Execute only works on Live databases")
+	}
+	if !strings.EqualFold(db.owner, user) {
+		return errorf(http.StatusForbidden, "Only the owner of a database can make changes to it")
+	}
+	statement, err := base64.StdEncoding.DecodeString(r.PostFormValue("sql"))
+	if err != nil {
+		return errorf(http.StatusBadRequest, "The SQL statement isn't base64 encoded: %s", err)
+	}
+	changed, err := execute(db.liveFile, string(statement))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, dbhub.ExecuteResponseContainer{RowsChanged: changed, Status: "OK"})
+}
+
+func (s *Server) handleIndexes(w http.ResponseWriter, r *http.Request, user string) error {
+	path, err := s.requestPath(r, user)
+	if err != nil {
+		return err
+	}
+	idx, err := indexes(path)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, idx)
+}
+
+func (s *Server) handleMetadata(w http.ResponseWriter, r *http.Request, user string) error {
+	db, err := s.requestStandardDB(r, user)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, dbhub.MetadataResponseContainer{
+		Branches:  db.branches,
+		Commits:   db.commits,
+		DefBranch: db.defaultBranch,
+		Releases:  db.releases,
+		Tags:      db.tags,
+		WebPage:   s.webPage(db),
+	})
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request, user string) error {
+	path, err := s.requestPath(r, user)
+	if err != nil {
+		return err
+	}
+	query, err := base64.StdEncoding.DecodeString(r.PostFormValue("sql"))
+	if err != nil {
+		return errorf(http.StatusBadRequest, "The SQL query isn't base64 encoded: %s", err)
+	}
+	rows, err := queryRows(path, string(query))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, rows)
+}
+
+func (s *Server) handleReleases(w http.ResponseWriter, r *http.Request, user string) error {
+	db, err := s.requestStandardDB(r, user)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, db.releases)
+}
+
+func (s *Server) handleTables(w http.ResponseWriter, r *http.Request, user string) error {
+	path, err := s.requestPath(r, user)
+	if err != nil {
+		return err
+	}
+	tbls, err := tables(path)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, tbls)
+}
+
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request, user string) error {
+	db, err := s.requestStandardDB(r, user)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, db.tags)
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, user string) error {
+	// Read the uploaded database file
+	if r.MultipartForm == nil || len(r.MultipartForm.File["file"]) == 0 {
+		return errorf(http.StatusBadRequest, "No database file was uploaded")
+	}
+	fh := r.MultipartForm.File["file"][0]
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	name := r.PostFormValue("dbname")
+	if name == "" {
+		name = fh.Filename
+	}
+
+	// Live databases don't have any version information
+	if r.PostFormValue("live") == "true" {
+		if err = s.uploadLive(user, name, data); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusCreated, map[string]string{"url": s.webPage(s.dbs[dbKey(user, name)])})
+	}
+
+	// Gather the commit details
+	info := dbhub.UploadInformation{
+		Ident:          identFromForm(r, ""),
+		CommitMsg:      r.PostFormValue("commitmsg"),
+		SourceURL:      r.PostFormValue("sourceurl"),
+		Licence:        r.PostFormValue("licence"),
+		Public:         r.PostFormValue("public"),
+		Force:          r.PostFormValue("force") == "true",
+		AuthorName:     r.PostFormValue("authorname"),
+		AuthorEmail:    r.PostFormValue("authoremail"),
+		CommitterName:  r.PostFormValue("committername"),
+		CommitterEmail: r.PostFormValue("committeremail"),
+		OtherParents:   r.PostFormValue("otherparents"),
+		ShaSum:         r.PostFormValue("dbshasum"),
+	}
+	for field, dst := range map[string]*time.Time{"lastmodified": &info.LastModified,
+		"committimestamp": &info.CommitTimestamp} {
+		if v := r.PostFormValue(field); v != "" {
+			if *dst, err = time.Parse(time.RFC3339, v); err != nil {
+				return errorf(http.StatusBadRequest, "Invalid %s value: %s", field, err)
+			}
+		}
+	}
+	commit, err := s.upload(user, name, data, info)
+	if err != nil {
+		return err
+	}
+	db := s.dbs[dbKey(user, name)]
+	return writeJSON(w, http.StatusCreated, map[string]string{"commit_id": commit,
+		"url": s.webPage(db) + "?commit=" + commit})
+}
+
+func (s *Server) handleViews(w http.ResponseWriter, r *http.Request, user string) error {
+	path, err := s.requestPath(r, user)
+	if err != nil {
+		return err
+	}
+	v, err := views(path)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) handleWebpage(w http.ResponseWriter, r *http.Request, user string) error {
+	db, err := s.requestDB(r, user)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, dbhub.WebpageResponseContainer{WebPage: s.webPage(db)})
+}
+
+// webPage returns the web page URL for a database
+func (s *Server) webPage(db *database) string {
+	return s.WebURL + "/" + db.owner + "/" + db.name
+}
+
+// uploadLive stores a new Live database
+func (s *Server) uploadLive(owner, name string, data []byte) error {
+	if _, ok := s.dbs[dbKey(owner, name)]; ok {
+		return errorf(http.StatusConflict, "A database named '%s' already exists", name)
+	}
+	if err := validateDB(data); err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(dbKey(owner, name)))
+	path := filepath.Join(s.dir, "live-"+hex.EncodeToString(sum[:]))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	s.dbs[dbKey(owner, name)] = &database{owner: owner, name: name, live: true, liveFile: path}
+	return nil
+}
+
+// upload stores a new standard database, or a new revision of an existing one, returning the ID of the new commit.
+// Like the real server, new revisions need the ID of the commit they're based on, unless info.Force is set.
+func (s *Server) upload(owner, name string, data []byte, info dbhub.UploadInformation) (string, error) {
+	if name == "" {
+		return "", errorf(http.StatusBadRequest, "Missing database name")
+	}
+	sum := sha256.Sum256(data)
+	sha := hex.EncodeToString(sum[:])
+	if info.ShaSum != "" && !strings.EqualFold(info.ShaSum, sha) {
+		return "", errorf(http.StatusBadRequest, "SHA256 of the uploaded database (%s) doesn't match the "+
+			"provided checksum (%s)", sha, info.ShaSum)
+	}
+	if err := validateDB(data); err != nil {
+		return "", err
+	}
+
+	// Work out which branch the new commit goes on, and its parent commit
+	db, exists := s.dbs[dbKey(owner, name)]
+	if exists && db.live {
+		return "", errorf(http.StatusConflict, "A Live database named '%s' already exists", name)
+	}
+	branch := info.Ident.Branch
+	var parent string
+	if !exists {
+		if branch == "" {
+			branch = "main"
+		}
+		db = &database{owner: owner, name: name, defaultBranch: branch,
+			commits:  make(map[string]dbhub.CommitEntry),
+			branches: make(map[string]dbhub.BranchEntry),
+			tags:     make(map[string]dbhub.TagEntry),
+			releases: make(map[string]dbhub.ReleaseEntry),
+		}
+	} else {
+		if branch == "" {
+			branch = db.defaultBranch
+		}
+		if b, ok := db.branches[branch]; ok {
+			parent = b.Commit
+			if !info.Force && info.Ident.CommitID == "" {
+				return "", errorf(http.StatusConflict, "The database already exists, so the ID of the commit "+
+					"being changed is needed")
+			}
+			if !info.Force && info.Ident.CommitID != parent {
+				return "", errorf(http.StatusConflict, "Commit '%s' isn't the head of branch '%s'. The database "+
+					"has been changed since", info.Ident.CommitID, branch)
+			}
+		} else {
+			// New branches start from the given commit
+			if _, ok := db.commits[info.Ident.CommitID]; !ok {
+				return "", errorf(http.StatusBadRequest, "Creating branch '%s' needs the ID of an existing commit "+
+					"to start it from", branch)
+			}
+			parent = info.Ident.CommitID
+		}
+	}
+
+	// Store the file and create the commit for it
+	if _, err := s.storeFile(data); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	lastModified := info.LastModified
+	if lastModified.IsZero() {
+		lastModified = now
+	}
+	entry := dbhub.DBTreeEntry{EntryType: dbhub.DATABASE, LastModified: lastModified.UTC(), Name: name,
+		Sha256: sha, Size: int64(len(data))}
+	if info.Licence != "" {
+		licSum := sha256.Sum256([]byte(info.Licence))
+		entry.LicenceSHA = hex.EncodeToString(licSum[:])
+	}
+	c := dbhub.CommitEntry{
+		AuthorName:     info.AuthorName,
+		AuthorEmail:    info.AuthorEmail,
+		CommitterName:  info.CommitterName,
+		CommitterEmail: info.CommitterEmail,
+		Message:        info.CommitMsg,
+		Parent:         parent,
+		Timestamp:      info.CommitTimestamp.UTC(),
+		Tree:           dbhub.DBTree{Entries: []dbhub.DBTreeEntry{entry}},
+	}
+	if c.AuthorName == "" {
+		c.AuthorName = owner
+	}
+	if c.AuthorEmail == "" {
+		c.AuthorEmail = owner + "@dbhub.test"
+	}
+	if info.CommitTimestamp.IsZero() {
+		c.Timestamp = now
+	}
+	if info.OtherParents != "" {
+		for _, p := range strings.Split(info.OtherParents, ",") {
+			if _, ok := db.commits[p]; !ok {
+				return "", errorf(http.StatusBadRequest, "Other parent commit '%s' doesn't exist", p)
+			}
+			c.OtherParents = append(c.OtherParents, p)
+		}
+	}
+	c.Tree.ID = treeID(c.Tree)
+	c.ID = commitID(c)
+
+	// Save everything
+	db.commits[c.ID] = c
+	db.branches[branch] = dbhub.BranchEntry{Commit: c.ID, CommitCount: db.commitCount(c.ID),
+		Description: db.branches[branch].Description}
+	if info.Public != "" {
+		db.public, _ = strconv.ParseBool(info.Public)
+	}
+	s.dbs[dbKey(owner, name)] = db
+	return c.ID, nil
+}
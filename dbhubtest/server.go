@@ -0,0 +1,267 @@
+// Package dbhubtest provides an in-process fake DBHub.io API server, for testing code which uses go-dbhub without
+// needing network access.
+//
+// The server implements all of the API end points used by dbhub.Connection.  Databases are stored as real SQLite
+// files in a temporary directory, and the commits, branches, tags, and releases of each database are kept in memory.
+//
+// To test how code copes with an unreliable server, faults such as slow responses, error statuses, and truncated
+// bodies can be injected into the responses of each end point with SetFault() and Script().
+//
+// Query results are encoded the same way as by the real server, including its handling of BLOBs.  These are sent as
+// JSON strings, so any bytes in them which aren't valid UTF-8 are replaced with U+FFFD.
+//
+//	srv := dbhubtest.NewServer()
+//	defer srv.Close()
+//	commitID, err := srv.AddDatabase(dbhubtest.DefaultUser, "example.sqlite", dbBytes, dbhub.UploadInformation{})
+//	conn, err := srv.Connection(dbhubtest.DefaultAPIKey)
+//	tables, err := conn.Tables(dbhubtest.DefaultUser, "example.sqlite", dbhub.Identifier{})
+package dbhubtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+const (
+	// DefaultUser is the name of the user account created with each new server
+	DefaultUser = "default"
+
+	// DefaultAPIKey is the API key of the default user
+	DefaultAPIKey = "dbhubtest-default-api-key"
+)
+
+// Server is a fake DBHub.io API server.  It's safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	// WebURL is the address used when generating web page URLs for databases
+	WebURL string
+
+	mu    sync.Mutex
+	dir   string               // The directory holding the database files
+	users map[string]string    // API key to user name
+	dbs   map[string]*database // Keyed by lower case owner name and database name
+
+	// Fault injection details, keyed by end point
+	calls   map[string]int
+	faults  map[string]Fault
+	scripts map[string][]Fault
+}
+
+// handlerFunc is the signature of the functions handling each API end point.  user is the name of the user the API key
+// of the request belongs to.
+type handlerFunc func(w http.ResponseWriter, r *http.Request, user string) error
+
+// NewServer starts a new fake DBHub.io API server, with a single user account (DefaultUser) and no databases.  The
+// server should be closed with Close() when it's no longer needed.
+func NewServer() *Server {
+	dir, err := os.MkdirTemp("", "dbhubtest-")
+	if err != nil {
+		panic(fmt.Sprintf("dbhubtest: creating the database directory failed: %v", err))
+	}
+	s := &Server{
+		WebURL:  "https://dbhub.test",
+		dir:     dir,
+		users:   map[string]string{DefaultAPIKey: DefaultUser},
+		dbs:     make(map[string]*database),
+		calls:   make(map[string]int),
+		faults:  make(map[string]Fault),
+		scripts: make(map[string][]Fault),
+	}
+	s.Server = httptest.NewServer(s.routes())
+	return s
+}
+
+// Close shuts down the server, and removes its database files
+func (s *Server) Close() {
+	s.Server.Close()
+	os.RemoveAll(s.dir)
+}
+
+// Connection returns a dbhub.Connection which talks to this server using the given API key
+func (s *Server) Connection(apiKey string, opts ...dbhub.Option) (dbhub.Connection, error) {
+	conn, err := dbhub.New(apiKey, opts...)
+	if err != nil {
+		return dbhub.Connection{}, err
+	}
+	conn.ChangeServer(s.URL)
+	return conn, nil
+}
+
+// AddUser adds a user account to the server
+func (s *Server) AddUser(name, apiKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[apiKey] = name
+}
+
+// AddDatabase stores a new standard database, or a new revision of an existing one, as if it had been uploaded by the
+// owner.  The ID of the new commit is returned.
+func (s *Server) AddDatabase(owner, name string, data []byte, info dbhub.UploadInformation) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.upload(owner, name, data, info)
+}
+
+// AddLiveDatabase stores a new Live database, as if it had been uploaded by the owner
+func (s *Server) AddLiveDatabase(owner, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploadLive(owner, name, data)
+}
+
+// AddBranch creates a new branch in a standard database, pointing at the given commit
+func (s *Server) AddBranch(owner, name, branch, commitID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	db, err := s.lookup(owner, owner, name)
+	if err != nil {
+		return err
+	}
+	if _, ok := db.commits[commitID]; !ok {
+		return fmt.Errorf("commit '%s' doesn't exist", commitID)
+	}
+	db.branches[branch] = dbhub.BranchEntry{Commit: commitID, CommitCount: db.commitCount(commitID)}
+	return nil
+}
+
+// AddTag creates a new tag in a standard database, pointing at the given commit
+func (s *Server) AddTag(owner, name, tag, commitID, description string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	db, err := s.lookup(owner, owner, name)
+	if err != nil {
+		return err
+	}
+	if _, ok := db.commits[commitID]; !ok {
+		return fmt.Errorf("commit '%s' doesn't exist", commitID)
+	}
+	db.tags[tag] = dbhub.TagEntry{Commit: commitID, Date: time.Now().UTC().Truncate(time.Second),
+		Description: description, TaggerName: owner, TaggerEmail: owner + "@dbhub.test"}
+	return nil
+}
+
+// AddRelease creates a new release in a standard database, pointing at the given commit
+func (s *Server) AddRelease(owner, name, release, commitID, description string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	db, err := s.lookup(owner, owner, name)
+	if err != nil {
+		return err
+	}
+	entry, err := db.dbEntry(commitID)
+	if err != nil {
+		return fmt.Errorf("commit '%s' doesn't exist", commitID)
+	}
+	db.releases[release] = dbhub.ReleaseEntry{Commit: commitID, Date: time.Now().UTC().Truncate(time.Second),
+		Description: description, ReleaserName: owner, ReleaserEmail: owner + "@dbhub.test", Size: entry.Size}
+	return nil
+}
+
+// SetPublic changes whether a database can be seen by users other than its owner
+func (s *Server) SetPublic(owner, name string, public bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	db, err := s.lookup(owner, owner, name)
+	if err != nil {
+		return err
+	}
+	db.public = public
+	return nil
+}
+
+// routes returns the handler for all of the API end points
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	for endpoint, h := range map[string]handlerFunc{
+		"/v1/branches":  s.handleBranches,
+		"/v1/columns":   s.handleColumns,
+		"/v1/commits":   s.handleCommits,
+		"/v1/databases": s.handleDatabases,
+		"/v1/delete":    s.handleDelete,
+		"/v1/diff":      s.handleDiff,
+		"/v1/download":  s.handleDownload,
+		"/v1/execute":   s.handleExecute,
+		"/v1/indexes":   s.handleIndexes,
+		"/v1/metadata":  s.handleMetadata,
+		"/v1/query":     s.handleQuery,
+		"/v1/releases":  s.handleReleases,
+		"/v1/tables":    s.handleTables,
+		"/v1/tags":      s.handleTags,
+		"/v1/upload":    s.handleUpload,
+		"/v1/views":     s.handleViews,
+		"/v1/webpage":   s.handleWebpage,
+	} {
+		mux.Handle(endpoint, s.injectFaults(endpoint, s.authenticate(h)))
+	}
+	return mux
+}
+
+// authenticate checks the API key of a request before passing it to the end point handler, and turns any error the
+// handler returns into a JSON error response
+func (s *Server) authenticate(h handlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, errorf(http.StatusMethodNotAllowed, "Only POST requests are supported"))
+			return
+		}
+
+		// The upload end point uses multi-part data, everything else is url encoded
+		var err error
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			err = r.ParseMultipartForm(32 << 20)
+		} else {
+			err = r.ParseForm()
+		}
+		if err != nil {
+			writeError(w, errorf(http.StatusBadRequest, "Couldn't parse the request: %s", err))
+			return
+		}
+
+		// Requests are handled one at a time, which keeps things simple as the server is only meant for testing
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		user, ok := s.users[r.PostFormValue("apikey")]
+		if !ok {
+			writeError(w, errorf(http.StatusUnauthorized, "Incorrect or unknown API key"))
+			return
+		}
+		if err = h(w, r, user); err != nil {
+			writeError(w, err)
+		}
+	})
+}
+
+// writeJSON sends a successful JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+	return nil
+}
+
+// writeError sends an error response, in the JSON format used by the DBHub.io server
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var se *serverError
+	if errors.As(err, &se) {
+		status = se.status
+	}
+	data, _ := json.Marshal(dbhub.JSONError{Msg: err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,311 @@
+package dbhubtest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDB returns the contents of a new SQLite database, created by running the given SQL statements
+func newDB(t *testing.T, statements ...string) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+	sdb, err := sqlite.Open(path)
+	require.NoError(t, err)
+	for _, s := range statements {
+		require.NoError(t, sdb.Exec(s))
+	}
+	require.NoError(t, sdb.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
+
+// newTestServer starts a server holding a standard database with two commits, and returns a connection to it
+func newTestServer(t *testing.T) (srv *Server, conn dbhub.Connection, commit1, commit2 string) {
+	t.Helper()
+	srv = NewServer()
+	t.Cleanup(srv.Close)
+	conn, err := srv.Connection(DefaultAPIKey)
+	require.NoError(t, err)
+
+	commit1, err = srv.AddDatabase(DefaultUser, "test.sqlite", newDB(t,
+		"CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT NOT NULL, age INTEGER)",
+		"INSERT INTO people VALUES (1, 'Alice', 30), (2, 'Bob', NULL)"), dbhub.UploadInformation{CommitMsg: "First"})
+	require.NoError(t, err)
+	commit2, err = srv.AddDatabase(DefaultUser, "test.sqlite", newDB(t,
+		"CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT NOT NULL, age INTEGER)",
+		"INSERT INTO people VALUES (1, 'Alice', 31), (3, 'Carol', 25)",
+		"CREATE INDEX people_name ON people (name)",
+		"CREATE VIEW adults AS SELECT name FROM people WHERE age >= 18"),
+		dbhub.UploadInformation{CommitMsg: "Second", Ident: dbhub.Identifier{CommitID: commit1}})
+	require.NoError(t, err)
+	return
+}
+
+// TestMetadata verifies the commit, branch, tag, and release information returned by the server
+func TestMetadata(t *testing.T) {
+	srv, conn, commit1, commit2 := newTestServer(t)
+	require.NoError(t, srv.AddBranch(DefaultUser, "test.sqlite", "dev", commit1))
+	require.NoError(t, srv.AddTag(DefaultUser, "test.sqlite", "v1", commit1, "First tag"))
+	require.NoError(t, srv.AddRelease(DefaultUser, "test.sqlite", "r1", commit2, "First release"))
+
+	branches, defaultBranch, err := conn.Branches(DefaultUser, "test.sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, "main", defaultBranch)
+	assert.Equal(t, commit2, branches["main"].Commit)
+	assert.Equal(t, 2, branches["main"].CommitCount)
+	assert.Equal(t, commit1, branches["dev"].Commit)
+
+	commits, err := conn.Commits(DefaultUser, "test.sqlite")
+	require.NoError(t, err)
+	require.Len(t, commits, 2)
+	assert.Equal(t, "Second", commits[commit2].Message)
+	assert.Equal(t, commit1, commits[commit2].Parent)
+	assert.Equal(t, DefaultUser, commits[commit2].AuthorName)
+
+	tags, err := conn.Tags(DefaultUser, "test.sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, commit1, tags["v1"].Commit)
+	assert.Equal(t, "First tag", tags["v1"].Description)
+
+	releases, err := conn.Releases(DefaultUser, "test.sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, commit2, releases["r1"].Commit)
+
+	meta, err := conn.Metadata(DefaultUser, "test.sqlite")
+	require.NoError(t, err)
+	assert.Len(t, meta.Commits, 2)
+	assert.Equal(t, "main", meta.DefBranch)
+	assert.Equal(t, "https://dbhub.test/default/test.sqlite", meta.WebPage)
+
+	page, err := conn.Webpage(DefaultUser, "test.sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, "https://dbhub.test/default/test.sqlite", page.WebPage)
+}
+
+// TestSchema verifies the table, view, index, and column information returned by the server
+func TestSchema(t *testing.T) {
+	_, conn, commit1, _ := newTestServer(t)
+
+	tbls, err := conn.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"people"}, tbls)
+
+	v, err := conn.Views(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"adults"}, v)
+
+	// The first commit didn't have the view or index yet
+	v, err = conn.Views(DefaultUser, "test.sqlite", dbhub.Identifier{CommitID: commit1})
+	require.NoError(t, err)
+	assert.Empty(t, v)
+
+	idx, err := conn.Indexes(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	require.NoError(t, err)
+	require.Len(t, idx, 1)
+	assert.Equal(t, "people_name", idx[0].Name)
+	assert.Equal(t, "people", idx[0].Table)
+	assert.Equal(t, "name", idx[0].Columns[0].Name)
+
+	cols, err := conn.Columns(DefaultUser, "test.sqlite", dbhub.Identifier{}, "people")
+	require.NoError(t, err)
+	require.Len(t, cols, 3)
+	assert.Equal(t, "id", cols[0].Name)
+	assert.Equal(t, 1, cols[0].Pk)
+	assert.True(t, cols[1].NotNull)
+
+	_, err = conn.Columns(DefaultUser, "test.sqlite", dbhub.Identifier{}, "missing")
+	assert.True(t, errors.Is(err, dbhub.ErrNotFound))
+}
+
+// TestQuery verifies running queries on the server
+func TestQuery(t *testing.T) {
+	_, conn, commit1, _ := newTestServer(t)
+
+	results, err := conn.QueryTyped(DefaultUser, "test.sqlite", dbhub.Identifier{CommitID: commit1},
+		"SELECT id, name, age FROM people ORDER BY id")
+	require.NoError(t, err)
+	assert.Equal(t, []dbhub.ResultColumn{{Name: "id", Type: dbhub.Integer}, {Name: "name", Type: dbhub.Text},
+		{Name: "age", Type: dbhub.Integer}}, results.Columns)
+	assert.Equal(t, [][]interface{}{{int64(1), "Alice", int64(30)}, {int64(2), "Bob", nil}}, results.Rows)
+
+	// Only read only statements can be run as queries
+	_, err = conn.Query(DefaultUser, "test.sqlite", dbhub.Identifier{}, false, "DELETE FROM people")
+	var apiErr *dbhub.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 400, apiErr.StatusCode)
+}
+
+// TestQueryBlobs verifies BLOBs are sent the same way as by the real server, which keeps valid UTF-8 bytes but
+// replaces invalid ones
+func TestQueryBlobs(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	conn, err := srv.Connection(DefaultAPIKey)
+	require.NoError(t, err)
+	_, err = srv.AddDatabase(DefaultUser, "blobs.sqlite", newDB(t,
+		"CREATE TABLE blobs (id INTEGER PRIMARY KEY, data BLOB)",
+		"INSERT INTO blobs VALUES (1, X'00C3A9'), (2, X'00FF80')"), dbhub.UploadInformation{})
+	require.NoError(t, err)
+
+	results, err := conn.QueryTyped(DefaultUser, "blobs.sqlite", dbhub.Identifier{}, "SELECT data FROM blobs ORDER BY id")
+	require.NoError(t, err)
+	require.Len(t, results.Rows, 2)
+	assert.Equal(t, []byte{0x00, 0xc3, 0xa9}, results.Rows[0][0])
+	assert.Equal(t, []byte{0x00, 0xef, 0xbf, 0xbd, 0xef, 0xbf, 0xbd}, results.Rows[1][0])
+
+	// The database itself is unchanged
+	db, err := conn.Download(DefaultUser, "blobs.sqlite", dbhub.Identifier{})
+	require.NoError(t, err)
+	defer db.Close()
+	data, err := io.ReadAll(db)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "blobs.sqlite")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	sdb, err := sqlite.Open(path)
+	require.NoError(t, err)
+	defer sdb.Close()
+	var blob []byte
+	err = sdb.OneValue("SELECT data FROM blobs WHERE id = 2", &blob)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0xff, 0x80}, blob)
+}
+
+// TestDiff verifies the differences between commits reported by the server
+func TestDiff(t *testing.T) {
+	_, conn, commit1, commit2 := newTestServer(t)
+
+	diffs, err := conn.Diff(DefaultUser, "test.sqlite", dbhub.Identifier{CommitID: commit1}, "", "",
+		dbhub.Identifier{CommitID: commit2}, dbhub.PreservePkMerge)
+	require.NoError(t, err)
+	require.Len(t, diffs.Diff, 3)
+
+	assert.Equal(t, "adults", diffs.Diff[0].ObjectName)
+	assert.Equal(t, "view", diffs.Diff[0].ObjectType)
+	assert.Equal(t, dbhub.ActionAdd, diffs.Diff[0].Schema.ActionType)
+	assert.Equal(t, "CREATE VIEW adults AS SELECT name FROM people WHERE age >= 18;", diffs.Diff[0].Schema.Sql)
+
+	assert.Equal(t, "people", diffs.Diff[1].ObjectName)
+	assert.Nil(t, diffs.Diff[1].Schema)
+	require.Len(t, diffs.Diff[1].Data, 3)
+	assert.Equal(t, `UPDATE "people" SET "age"=31 WHERE "id"=1;`, diffs.Diff[1].Data[0].Sql)
+	assert.Equal(t, `DELETE FROM "people" WHERE "id"=2;`, diffs.Diff[1].Data[1].Sql)
+	assert.Equal(t, `INSERT INTO "people"("id","name","age") VALUES(3,'Carol',25);`, diffs.Diff[1].Data[2].Sql)
+
+	assert.Equal(t, "people_name", diffs.Diff[2].ObjectName)
+	assert.Equal(t, "index", diffs.Diff[2].ObjectType)
+
+	// New primary key values are left for the database to generate
+	diffs, err = conn.Diff(DefaultUser, "test.sqlite", dbhub.Identifier{CommitID: commit1}, "", "",
+		dbhub.Identifier{CommitID: commit2}, dbhub.NewPkMerge)
+	require.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "people"("name","age") VALUES('Carol',25);`, diffs.Diff[1].Data[2].Sql)
+
+	// Without a merge strategy there's no SQL
+	diffs, err = conn.Diff(DefaultUser, "test.sqlite", dbhub.Identifier{CommitID: commit1}, "", "",
+		dbhub.Identifier{CommitID: commit2}, dbhub.NoMerge)
+	require.NoError(t, err)
+	assert.Empty(t, diffs.Diff[0].Schema.Sql)
+	assert.Empty(t, diffs.Diff[1].Data[0].Sql)
+}
+
+// TestUploadDownload verifies uploading new databases and revisions, then downloading them again
+func TestUploadDownload(t *testing.T) {
+	_, conn, _, commit2 := newTestServer(t)
+
+	dbBytes, err := os.ReadFile(filepath.Join("..", "examples", "upload", "example.db"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Upload("example.db", dbhub.UploadInformation{CommitMsg: "Example"}, &dbBytes))
+
+	body, err := conn.Download(DefaultUser, "example.db", dbhub.Identifier{})
+	require.NoError(t, err)
+	downloaded, err := io.ReadAll(body)
+	body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, dbBytes, downloaded)
+
+	dbs, err := conn.Databases()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.db", "test.sqlite"}, dbs)
+
+	// New revisions must be based on the head of their branch, unless forced
+	newBytes := newDB(t, "CREATE TABLE t (a)")
+	err = conn.Upload("test.sqlite", dbhub.UploadInformation{}, &newBytes)
+	assert.True(t, errors.Is(err, dbhub.ErrConflict))
+	err = conn.Upload("test.sqlite", dbhub.UploadInformation{Ident: dbhub.Identifier{CommitID: commit2}}, &newBytes)
+	require.NoError(t, err)
+	tbls, err := conn.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{Branch: "main"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t"}, tbls)
+
+	// Mismatched checksums and files which aren't SQLite databases are rejected
+	err = conn.Upload("other.sqlite", dbhub.UploadInformation{ShaSum: "abc"}, &newBytes)
+	assert.Error(t, err)
+	junk := []byte("not a database")
+	err = conn.Upload("junk.sqlite", dbhub.UploadInformation{}, &junk)
+	assert.Error(t, err)
+
+	require.NoError(t, conn.Delete("example.db"))
+	_, err = conn.Download(DefaultUser, "example.db", dbhub.Identifier{})
+	assert.True(t, errors.Is(err, dbhub.ErrNotFound))
+}
+
+// TestLive verifies uploading, changing, and querying Live databases
+func TestLive(t *testing.T) {
+	_, conn, _, _ := newTestServer(t)
+
+	dbBytes := newDB(t, "CREATE TABLE counts (n INTEGER)", "INSERT INTO counts VALUES (1), (2)")
+	require.NoError(t, conn.UploadLive("live.sqlite", &dbBytes))
+
+	dbs, err := conn.DatabasesLive()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"live.sqlite"}, dbs)
+
+	changed, err := conn.Execute(DefaultUser, "live.sqlite", "UPDATE counts SET n = n + 10")
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+
+	var rows []struct{ N int }
+	require.NoError(t, conn.QueryInto(DefaultUser, "live.sqlite", dbhub.Identifier{}, "SELECT n FROM counts ORDER BY n",
+		&rows))
+	assert.Equal(t, []struct{ N int }{{11}, {12}}, rows)
+
+	// Live databases don't have commits
+	_, err = conn.Commits(DefaultUser, "live.sqlite")
+	assert.Error(t, err)
+}
+
+// TestAccess verifies API keys are checked, and private databases are hidden from other users
+func TestAccess(t *testing.T) {
+	srv, conn, _, _ := newTestServer(t)
+
+	bad, err := srv.Connection("wrong key")
+	require.NoError(t, err)
+	_, err = bad.Databases()
+	assert.True(t, errors.Is(err, dbhub.ErrUnauthorized))
+
+	srv.AddUser("other", "other-key")
+	other, err := srv.Connection("other-key")
+	require.NoError(t, err)
+	_, err = other.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	assert.True(t, errors.Is(err, dbhub.ErrNotFound))
+
+	require.NoError(t, srv.SetPublic(DefaultUser, "test.sqlite", true))
+	tbls, err := other.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"people"}, tbls)
+
+	// Only the owner can delete a database
+	err = other.Delete("test.sqlite")
+	assert.True(t, errors.Is(err, dbhub.ErrNotFound))
+	_, err = conn.Tables(DefaultUser, "test.sqlite", dbhub.Identifier{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,186 @@
+package dbhubtest
+
+import (
+	"net/http"
+	"os"
+	"sort"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+// openDB opens a database file.  Standard database revisions never change, so unless writable is set the file is
+// opened read only.
+func openDB(path string, writable bool) (*sqlite.Conn, error) {
+	if writable {
+		return sqlite.Open(path, sqlite.OpenReadWrite|sqlite.OpenFullMutex)
+	}
+	return sqlite.Open(path, sqlite.OpenReadOnly|sqlite.OpenFullMutex)
+}
+
+// validateDB checks the given data is a SQLite database
+func validateDB(data []byte) error {
+	f, err := os.CreateTemp("", "dbhubtest-*.sqlite")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	sdb, err := openDB(f.Name(), false)
+	if err != nil {
+		return errorf(http.StatusBadRequest, "The uploaded file isn't a SQLite database: %s", err)
+	}
+	defer sdb.Close()
+	var n int
+	if err = sdb.OneValue("SELECT count(*) FROM sqlite_master", &n); err != nil {
+		return errorf(http.StatusBadRequest, "The uploaded file isn't a SQLite database: %s", err)
+	}
+	return nil
+}
+
+// queryRows runs a read only SQL query on a database file, returning the results in the format used by the query end
+// point
+func queryRows(path, query string) (rows []dbhub.DataRow, err error) {
+	sdb, err := openDB(path, false)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+	stmt, err := sdb.Prepare(query)
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "%s", err)
+	}
+	defer stmt.Finalize()
+	if !stmt.ReadOnly() {
+		return nil, errorf(http.StatusBadRequest, "Only read only statements (eg SELECT) can be run as queries")
+	}
+	rows = []dbhub.DataRow{}
+	for {
+		var ok bool
+		ok, err = stmt.Next()
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "%s", err)
+		}
+		if !ok {
+			return
+		}
+		row := make(dbhub.DataRow, stmt.ColumnCount())
+		for i := range row {
+			row[i].Name = stmt.ColumnName(i)
+			row[i].Value, row[i].Type = dataValue(stmt, i)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// dataValue returns a result value and its type, as sent by the query end point.  Like the real server, BLOBs are sent
+// as strings holding their raw bytes.  When they're encoded as JSON any bytes which aren't valid UTF-8 are replaced
+// with U+FFFD, so only BLOBs holding valid UTF-8 come back from a query unchanged.
+func dataValue(stmt *sqlite.Stmt, i int) (interface{}, dbhub.ValType) {
+	v, isNull := stmt.ScanValue(i)
+	if isNull {
+		return nil, dbhub.Null
+	}
+	switch val := v.(type) {
+	case int64:
+		return val, dbhub.Integer
+	case float64:
+		return val, dbhub.Float
+	case []byte:
+		return string(val), dbhub.Binary
+	}
+	return v, dbhub.Text
+}
+
+// execute runs a SQL statement on a database file, returning the number of rows changed
+func execute(path, statement string) (int, error) {
+	sdb, err := openDB(path, true)
+	if err != nil {
+		return 0, err
+	}
+	defer sdb.Close()
+	changed, err := sdb.ExecDml(statement)
+	if err != nil {
+		return 0, errorf(http.StatusBadRequest, "%s", err)
+	}
+	return changed, nil
+}
+
+// tables returns the sorted list of tables in a database file
+func tables(path string) ([]string, error) {
+	sdb, err := openDB(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+	tbls, err := sdb.Tables("")
+	sort.Strings(tbls)
+	return tbls, err
+}
+
+// views returns the sorted list of views in a database file
+func views(path string) ([]string, error) {
+	sdb, err := openDB(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+	v, err := sdb.Views("")
+	sort.Strings(v)
+	return v, err
+}
+
+// indexes returns the indexes in a database file, sorted by name
+func indexes(path string) ([]dbhub.APIJSONIndex, error) {
+	sdb, err := openDB(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+	idx, err := sdb.Indexes("")
+	if err != nil {
+		return nil, err
+	}
+	out := []dbhub.APIJSONIndex{}
+	for name, table := range idx {
+		cols, err := sdb.IndexColumns("", name)
+		if err != nil {
+			return nil, err
+		}
+		i := dbhub.APIJSONIndex{Name: name, Table: table, Columns: []dbhub.APIJSONIndexColumn{}}
+		for _, c := range cols {
+			i.Columns = append(i.Columns, dbhub.APIJSONIndexColumn{CID: c.Cid, Name: c.Name})
+		}
+		out = append(out, i)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out, nil
+}
+
+// columns returns the column details of a table or view in a database file
+func columns(path, table string) ([]dbhub.APIJSONColumn, error) {
+	sdb, err := openDB(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+	cols, err := sdb.Columns("", table)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, errorf(http.StatusNotFound, "Table or view '%s' doesn't exist", table)
+	}
+	out := make([]dbhub.APIJSONColumn, 0, len(cols))
+	for _, c := range cols {
+		out = append(out, dbhub.APIJSONColumn{Cid: c.Cid, Name: c.Name, DataType: c.DataType, NotNull: c.NotNull,
+			DfltValue: c.DfltValue, Pk: c.Pk})
+	}
+	return out, nil
+}
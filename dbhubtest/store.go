@@ -0,0 +1,189 @@
+package dbhubtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+)
+
+// database holds the details of a database stored on the server
+type database struct {
+	owner  string
+	name   string
+	live   bool
+	public bool
+
+	// Live databases are a single file which is changed in place
+	liveFile string
+
+	// Standard databases keep all of their revisions, with each commit pointing at a content addressed file
+	commits       map[string]dbhub.CommitEntry
+	branches      map[string]dbhub.BranchEntry
+	defaultBranch string
+	tags          map[string]dbhub.TagEntry
+	releases      map[string]dbhub.ReleaseEntry
+}
+
+// serverError is an error which is returned to the client with the given http status code
+type serverError struct {
+	status int
+	msg    string
+}
+
+func (e *serverError) Error() string {
+	return e.msg
+}
+
+// errorf creates a serverError with the given status code and formatted message
+func errorf(status int, format string, args ...interface{}) error {
+	return &serverError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// dbKey returns the key used for a database in the server's database map
+func dbKey(owner, name string) string {
+	return strings.ToLower(owner) + "/" + name
+}
+
+// storeFile saves database file contents in the content addressed file store, returning its SHA256
+func (s *Server) storeFile(data []byte) (sha string, err error) {
+	sum := sha256.Sum256(data)
+	sha = hex.EncodeToString(sum[:])
+	path := filepath.Join(s.dir, sha)
+	if _, err = os.Stat(path); err == nil {
+		return
+	}
+	err = os.WriteFile(path, data, 0600)
+	return
+}
+
+// filePath returns the path of a file in the content addressed file store
+func (s *Server) filePath(sha string) string {
+	return filepath.Join(s.dir, sha)
+}
+
+// lookup returns a database the user is allowed to access.  Other people's databases can only be seen when public,
+// and databases which can't be accessed are reported as missing so their existence isn't leaked.
+func (s *Server) lookup(user, owner, name string) (*database, error) {
+	if owner == "" {
+		owner = user
+	}
+	db, ok := s.dbs[dbKey(owner, name)]
+	if !ok || (!db.public && !strings.EqualFold(db.owner, user)) {
+		return nil, errorf(http.StatusNotFound, "Database '%s/%s' doesn't exist", owner, name)
+	}
+	return db, nil
+}
+
+// resolve returns the commit ID an identifier points to.  An empty identifier means the head of the default branch.
+func (db *database) resolve(ident dbhub.Identifier) (string, error) {
+	switch {
+	case ident.CommitID != "":
+		if _, ok := db.commits[ident.CommitID]; !ok {
+			return "", errorf(http.StatusNotFound, "Commit '%s' doesn't exist", ident.CommitID)
+		}
+		return ident.CommitID, nil
+	case ident.Tag != "":
+		t, ok := db.tags[ident.Tag]
+		if !ok {
+			return "", errorf(http.StatusNotFound, "Tag '%s' doesn't exist", ident.Tag)
+		}
+		return t.Commit, nil
+	case ident.Release != "":
+		r, ok := db.releases[ident.Release]
+		if !ok {
+			return "", errorf(http.StatusNotFound, "Release '%s' doesn't exist", ident.Release)
+		}
+		return r.Commit, nil
+	}
+	branch := ident.Branch
+	if branch == "" {
+		branch = db.defaultBranch
+	}
+	b, ok := db.branches[branch]
+	if !ok {
+		return "", errorf(http.StatusNotFound, "Branch '%s' doesn't exist", branch)
+	}
+	return b.Commit, nil
+}
+
+// dbEntry returns the tree entry for the database file of a commit
+func (db *database) dbEntry(commitID string) (dbhub.DBTreeEntry, error) {
+	for _, e := range db.commits[commitID].Tree.Entries {
+		if e.EntryType == dbhub.DATABASE {
+			return e, nil
+		}
+	}
+	return dbhub.DBTreeEntry{}, errorf(http.StatusInternalServerError, "Commit '%s' has no database file", commitID)
+}
+
+// path returns the path of the database file for the given identifier, along with the commit it resolved to.  Live
+// databases only have one version, so the identifier is ignored for them.
+func (s *Server) path(db *database, ident dbhub.Identifier) (path, commitID string, err error) {
+	if db.live {
+		return db.liveFile, "", nil
+	}
+	commitID, err = db.resolve(ident)
+	if err != nil {
+		return
+	}
+	var entry dbhub.DBTreeEntry
+	entry, err = db.dbEntry(commitID)
+	if err != nil {
+		return
+	}
+	return s.filePath(entry.Sha256), commitID, nil
+}
+
+// commitCount returns the number of commits in the history of a commit, following the first parent of each
+func (db *database) commitCount(commitID string) (n int) {
+	for id := commitID; id != ""; id = db.commits[id].Parent {
+		n++
+	}
+	return
+}
+
+// commitID calculates the ID of a commit from its contents
+func commitID(c dbhub.CommitEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "tree %s\n", c.Tree.ID)
+	if c.Parent != "" {
+		fmt.Fprintf(&b, "parent %s\n", c.Parent)
+	}
+	for _, p := range c.OtherParents {
+		fmt.Fprintf(&b, "parent %s\n", p)
+	}
+	fmt.Fprintf(&b, "author %s <%s> %s\n", c.AuthorName, c.AuthorEmail, c.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(&b, "committer %s <%s> %s\n\n", c.CommitterName, c.CommitterEmail, c.Timestamp.Format(time.RFC3339))
+	b.WriteString(c.Message)
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// treeID calculates the ID of a tree from its entries
+func treeID(t dbhub.DBTree) string {
+	var b strings.Builder
+	for _, e := range t.Entries {
+		fmt.Fprintf(&b, "%s %s %s %d %s %s\n", e.EntryType, e.Sha256, e.LicenceSHA, e.Size,
+			e.LastModified.Format(time.RFC3339), e.Name)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(m map[string]*database) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
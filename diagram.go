@@ -0,0 +1,248 @@
+package dbhub
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSummary is the longest commit message summary shown in diagrams, in characters
+const maxSummary = 40
+
+// mermaidName matches branch names which can be used in Mermaid without quoting
+var mermaidName = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+// DOT returns the commit history as a Graphviz DOT graph, with the newest commits on the right.  Each commit points to
+// its parents, with dashed lines to the parents being merged in.  Branches, tags, and releases are shown as labels
+// pointing at their commits.
+//
+//	dot -Tsvg history.dot > history.svg
+func (g *CommitGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph history {\n")
+	b.WriteString("  rankdir=RL;\n")
+	b.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	ids := g.topoSort()
+	for _, id := range ids {
+		fmt.Fprintf(&b, "  %s [label=%s];\n", dotQuote(id), dotQuote(shortID(id)+"\n"+summary(g.Commits[id].Message)))
+	}
+	for _, id := range ids {
+		for i, p := range g.Parents(id) {
+			style := ""
+			if i > 0 {
+				style = " [style=dashed]"
+			}
+			fmt.Fprintf(&b, "  %s -> %s%s;\n", dotQuote(id), dotQuote(p), style)
+		}
+	}
+
+	// Labels for the branches, tags, and releases
+	label := func(kind, name, commitID, attrs string) {
+		if _, ok := g.Commits[commitID]; !ok {
+			return
+		}
+		node := dotQuote(kind + ":" + name)
+		fmt.Fprintf(&b, "  %s [label=%s, %s];\n", node, dotQuote(name), attrs)
+		fmt.Fprintf(&b, "  %s -> %s [style=dotted, arrowhead=none];\n", node, dotQuote(commitID))
+	}
+	for _, name := range sortedKeys(g.Branches) {
+		label("branch", name, g.Branches[name].Commit, `shape=box, style="rounded,filled", fillcolor="lightblue"`)
+	}
+	for _, name := range sortedKeys(g.Tags) {
+		label("tag", name, g.Tags[name].Commit, `shape=note, style=filled, fillcolor="lightyellow"`)
+	}
+	for _, name := range sortedKeys(g.Releases) {
+		label("release", name, g.Releases[name].Commit, `shape=note, style=filled, fillcolor="palegreen"`)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid returns the commit history as a Mermaid gitGraph diagram.  Each branch gets its own lane, following the
+// first parent of each commit back from the head of the branch, with the default branch first.  Commits which are
+// only reachable through merges of branches which have since been removed are shown on lanes named "unnamed-1",
+// "unnamed-2", and so on.  Tags and releases are shown as commit tags.
+//
+// Mermaid can only show merges of the latest commit on a lane, with a single parent being merged in, so other merges
+// are shown as normal commits.
+func (g *CommitGraph) Mermaid() string {
+	lane, lanes := g.lanes()
+
+	// Work out where each lane branches off from
+	forks := make(map[string][]string)
+	for _, l := range lanes {
+		if parents := g.Parents(l.start); len(parents) > 0 {
+			forks[parents[0]] = append(forks[parents[0]], l.name)
+		}
+	}
+
+	// Commits are added oldest first, so each commit comes after its parents
+	ids := g.topoSort()
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	labels := g.commitLabels()
+
+	var b strings.Builder
+	current := ""
+	if len(ids) > 0 {
+		current = lane[ids[0]]
+		if current != "main" {
+			fmt.Fprintf(&b, "%%%%{init: {\"gitGraph\": {\"mainBranchName\": %s}}}%%%%\n", mermaidQuote(current))
+		}
+	}
+	b.WriteString("gitGraph\n")
+	created := map[string]bool{current: true}
+	heads := make(map[string]string)
+	for _, id := range ids {
+		l := lane[id]
+		if !created[l] {
+			// Lanes which don't branch off from anything (ie unrelated histories) start from wherever we are
+			fmt.Fprintf(&b, "  branch %s\n", mermaidBranch(l))
+			created[l] = true
+			current = l
+		}
+		if current != l {
+			fmt.Fprintf(&b, "  checkout %s\n", mermaidBranch(l))
+			current = l
+		}
+		attrs := "id: " + mermaidQuote(shortID(id)+" "+summary(g.Commits[id].Message))
+		if labels[id] != "" {
+			attrs += " tag: " + mermaidQuote(labels[id])
+		}
+		parents := g.Parents(id)
+		if len(parents) > 1 && lane[parents[1]] != l && heads[lane[parents[1]]] == parents[1] {
+			fmt.Fprintf(&b, "  merge %s %s\n", mermaidBranch(lane[parents[1]]), attrs)
+		} else {
+			fmt.Fprintf(&b, "  commit %s\n", attrs)
+		}
+		heads[l] = id
+
+		// Start the lanes which branch off from this commit
+		for i, f := range forks[id] {
+			if i > 0 {
+				fmt.Fprintf(&b, "  checkout %s\n", mermaidBranch(l))
+			}
+			fmt.Fprintf(&b, "  branch %s\n", mermaidBranch(f))
+			created[f] = true
+			heads[f] = id
+			current = f
+		}
+	}
+	return b.String()
+}
+
+// lane is a line of commits in a Mermaid diagram, following the first parents back from the head of a branch
+type lane struct {
+	name  string
+	start string // The oldest commit on the lane
+}
+
+// lanes assigns each commit to a lane, returning the lane of each commit along with the lanes in the order they're
+// shown
+func (g *CommitGraph) lanes() (commitLane map[string]string, lanes []lane) {
+	commitLane = make(map[string]string)
+	addLane := func(name, head string) {
+		if _, done := commitLane[head]; done {
+			return
+		}
+		l := lane{name: name}
+		for id := head; id != ""; {
+			if _, done := commitLane[id]; done {
+				break
+			}
+			commitLane[id] = name
+			l.start = id
+			id = ""
+			if parents := g.Parents(l.start); len(parents) > 0 {
+				id = parents[0]
+			}
+		}
+		lanes = append(lanes, l)
+	}
+
+	// The default branch goes first, then the other branches in alphabetical order
+	names := sortedKeys(g.Branches)
+	if _, ok := g.Branches[g.DefaultBranch]; ok {
+		names = append([]string{g.DefaultBranch}, names...)
+	}
+	for _, name := range names {
+		if _, ok := g.Commits[g.Branches[name].Commit]; ok {
+			addLane(name, g.Branches[name].Commit)
+		}
+	}
+	n := 0
+	for _, id := range g.topoSort() {
+		if _, done := commitLane[id]; !done {
+			n++
+			addLane(fmt.Sprintf("unnamed-%d", n), id)
+		}
+	}
+	return
+}
+
+// commitLabels returns the tags and releases of each commit, as a comma separated list
+func (g *CommitGraph) commitLabels() map[string]string {
+	labels := make(map[string][]string)
+	for _, name := range sortedKeys(g.Tags) {
+		labels[g.Tags[name].Commit] = append(labels[g.Tags[name].Commit], name)
+	}
+	for _, name := range sortedKeys(g.Releases) {
+		labels[g.Releases[name].Commit] = append(labels[g.Releases[name].Commit], "release "+name)
+	}
+	joined := make(map[string]string, len(labels))
+	for id, l := range labels {
+		joined[id] = strings.Join(l, ", ")
+	}
+	return joined
+}
+
+// sortedKeys returns the keys of a map in alphabetical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shortID returns the abbreviated form of a commit ID shown in diagrams
+func shortID(commitID string) string {
+	if len(commitID) > 8 {
+		return commitID[:8]
+	}
+	return commitID
+}
+
+// summary returns the first line of a commit message, shortened if it's long
+func summary(msg string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(msg), "\n")
+	line = strings.TrimSpace(line)
+	if utf8.RuneCountInString(line) > maxSummary {
+		line = string([]rune(line)[:maxSummary-3]) + "..."
+	}
+	return line
+}
+
+// dotQuote returns a string as a quoted DOT ID, turning newlines into DOT line breaks
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+// mermaidQuote returns a string quoted for Mermaid.  Mermaid has no way to escape double quotes, so they're changed
+// to single quotes.
+func mermaidQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, `'`, "\n", " ").Replace(s) + `"`
+}
+
+// mermaidBranch returns a branch name for use in a Mermaid diagram, quoting it if needed
+func mermaidBranch(name string) string {
+	if mermaidName.MatchString(name) {
+		return name
+	}
+	return mermaidQuote(name)
+}
@@ -0,0 +1,65 @@
+package dbhub_test
+
+import (
+	"testing"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDOT verifies commit histories are exported as Graphviz graphs
+func TestDOT(t *testing.T) {
+	dot := testGraph().DOT()
+	assert.Contains(t, dot, "digraph history {\n")
+	assert.Contains(t, dot, `  "M" [label="M\nMerge feature into main"];`+"\n")
+	assert.Contains(t, dot, `  "M" -> "C";`+"\n")
+	assert.Contains(t, dot, `  "M" -> "E" [style=dashed];`+"\n")
+	assert.Contains(t, dot, `  "branch:feature" -> "E" [style=dotted, arrowhead=none];`+"\n")
+	assert.Contains(t, dot, `  "tag:v1" [label="v1", shape=note, style=filled, fillcolor="lightyellow"];`+"\n")
+
+	// Quotes and long messages
+	g := dbhub.NewCommitGraph(dbhub.MetadataResponseContainer{Commits: map[string]dbhub.CommitEntry{
+		"0123456789abcdef": {Message: "Say \"hello\" to everyone in the world, one at a time\n\nDetails"},
+	}})
+	assert.Contains(t, g.DOT(),
+		`  "0123456789abcdef" [label="01234567\nSay \"hello\" to everyone in the world,..."];`+"\n")
+}
+
+// TestMermaid verifies commit histories are exported as Mermaid gitGraph diagrams
+func TestMermaid(t *testing.T) {
+	g := testGraph()
+	assert.Equal(t, `gitGraph
+  commit id: "A Initial commit"
+  commit id: "B Add the users table" tag: "v1"
+  branch feature
+  checkout main
+  commit id: "C Fix a typo"
+  checkout feature
+  commit id: "D Start the new feature"
+  commit id: "E Finish the new FEATURE"
+  checkout main
+  merge feature id: "M Merge feature into main"
+`, g.Mermaid())
+
+	// Once the feature branch is gone its commits get an unnamed lane, and other default branch names are set up
+	g = dbhub.NewCommitGraph(dbhub.MetadataResponseContainer{
+		Commits:   g.Commits,
+		Branches:  map[string]dbhub.BranchEntry{"master": {Commit: "M"}},
+		Tags:      g.Tags,
+		Releases:  map[string]dbhub.ReleaseEntry{"2023.1": {Commit: "M"}},
+		DefBranch: "master",
+	})
+	assert.Equal(t, `%%{init: {"gitGraph": {"mainBranchName": "master"}}}%%
+gitGraph
+  commit id: "A Initial commit"
+  commit id: "B Add the users table" tag: "v1"
+  branch unnamed-1
+  checkout master
+  commit id: "C Fix a typo"
+  checkout unnamed-1
+  commit id: "D Start the new feature"
+  commit id: "E Finish the new FEATURE"
+  checkout master
+  merge unnamed-1 id: "M Merge feature into main" tag: "release 2023.1"
+`, g.Mermaid())
+}
@@ -0,0 +1,272 @@
+package dbhub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DownloadVerified downloads a standard database, checking it against the size and SHA256 recorded in its commit
+// before handing it over.  The identifier is resolved to a commit first, and that exact commit is downloaded, so the
+// database can't change part way through.  The database is held in a temporary file, which is removed when the
+// returned reader is closed, or read from the cache if the connection has one.  If the check fails, the error is a
+// *VerificationError.
+func (c Connection) DownloadVerified(ctx context.Context, dbOwner, dbName string, ident Identifier) (db io.ReadCloser, commitID string, err error) {
+	var entry DBTreeEntry
+	commitID, entry, err = c.resolveEntry(ctx, dbOwner, dbName, ident)
+	if err != nil {
+		return
+	}
+	if c.cache != nil {
+		db, err = c.downloadCached(ctx, dbOwner, dbName, commitID, entry)
+		return
+	}
+	var f *os.File
+	f, err = os.CreateTemp("", "dbhub-*.sqlite")
+	if err != nil {
+		return
+	}
+	tmp := tempFile{f}
+	if err = c.downloadCommit(ctx, dbOwner, dbName, commitID, entry, f); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		return
+	}
+	db = tmp
+	return
+}
+
+// DownloadToFile downloads a standard database into a file, checking it against the size and SHA256 recorded in its
+// commit.  The ID of the downloaded commit is returned.  If the check fails, the error is a *VerificationError.
+//
+// The database is written to a partial file alongside the destination, which is only renamed into place once the
+// check has passed, so an existing file at path is never left half written.  If the download is interrupted, the
+// partial file is kept and the download resumes from where it stopped, using an HTTP Range request.  This happens
+// within the call when the connection's retry policy allows more attempts, otherwise on the next call for the same
+// database revision.  Servers which ignore the Range request just send the whole database again.
+func (c Connection) DownloadToFile(ctx context.Context, dbOwner, dbName string, ident Identifier, path string) (commitID string, err error) {
+	var entry DBTreeEntry
+	commitID, entry, err = c.resolveEntry(ctx, dbOwner, dbName, ident)
+	if err != nil {
+		return
+	}
+	err = c.downloadToFile(ctx, dbOwner, dbName, commitID, entry, path)
+	return
+}
+
+// downloadToFile downloads the database file of a commit into a file, checking it against the given tree entry
+func (c Connection) downloadToFile(ctx context.Context, dbOwner, dbName, commitID string, entry DBTreeEntry, path string) (err error) {
+	// The partial file is named after the SHA256 of the database revision, so it can't be resumed with the wrong data
+	sha := entry.Sha256
+	if len(sha) > 16 {
+		sha = sha[:16]
+	}
+	partPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+sha+".part")
+	var f *os.File
+	f, err = os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	err = c.downloadResumable(ctx, dbOwner, dbName, commitID, entry, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	// Data which failed the check is no use for resuming, but anything else is kept for the next attempt
+	var verr *VerificationError
+	if errors.As(err, &verr) {
+		os.Remove(partPath)
+	}
+	if err != nil {
+		return
+	}
+	err = os.Rename(partPath, path)
+	return
+}
+
+// downloadResumable downloads the database file of a commit into f, carrying on from any data already in f.  Its
+// size and SHA256 are checked once the download is complete.
+func (c Connection) downloadResumable(ctx context.Context, dbOwner, dbName, commitID string, entry DBTreeEntry, f *os.File) (err error) {
+	// Hash the data already downloaded.  If there's more than there should be, it's not worth keeping.
+	h := sha256.New()
+	var offset int64
+	offset, err = io.Copy(h, io.LimitReader(f, entry.Size+1))
+	if err != nil {
+		return
+	}
+	if offset > entry.Size {
+		if offset, err = restart(f, h); err != nil {
+			return
+		}
+	}
+
+	// Each request is only sent once, and this loop does the retrying instead.  That way a failed request and a
+	// download which breaks off part way through share the one retry budget, and retries carry on from the data
+	// already received.
+	attempts := c.retry.attempts("/v1/download")
+	once := c
+	once.retry.MaxAttempts = 1
+	for attempt := 1; offset < entry.Size; attempt++ {
+		var header http.Header
+		if offset > 0 {
+			header = http.Header{"Range": {fmt.Sprintf("bytes=%d-", offset)}}
+		}
+		var resp *http.Response
+		resp, err = once.post(ctx, "/v1/download", c.PrepareVals(dbOwner, dbName, Identifier{CommitID: commitID}), header)
+		if err != nil {
+			if err = c.retryWait(ctx, attempt, attempts, err); err != nil {
+				return
+			}
+			continue
+		}
+
+		// Make sure the server sent the part we asked for.  If it sent the whole database instead, start again.
+		if resp.StatusCode == http.StatusPartialContent {
+			var start int64
+			contentRange := resp.Header.Get("Content-Range")
+			if _, scanErr := fmt.Sscanf(contentRange, "bytes %d-", &start); scanErr != nil || start != offset {
+				resp.Body.Close()
+				return fmt.Errorf("the server sent an unexpected part of the database: '%s'", contentRange)
+			}
+		} else if offset > 0 {
+			if offset, err = restart(f, h); err != nil {
+				resp.Body.Close()
+				return
+			}
+		}
+
+		// Don't read more than one byte past the expected size, as that's enough to know the size is wrong
+		body := newProgressReader(resp.Body, c.options().progress, "/v1/download", dbName, offset, entry.Size)
+		var n int64
+		n, err = io.Copy(io.MultiWriter(f, h), io.LimitReader(body, entry.Size-offset+1))
+		resp.Body.Close()
+		offset += n
+		if err == nil {
+			break
+		}
+
+		if err = c.retryWait(ctx, attempt, attempts, err); err != nil {
+			return
+		}
+	}
+	return verify(commitID, entry, offset, hex.EncodeToString(h.Sum(nil)))
+}
+
+// retryWait waits before the next attempt at a download.  The error is returned instead if it isn't likely to go away,
+// there are no attempts left, or the server wants us to wait too long.
+func (c Connection) retryWait(ctx context.Context, attempt, attempts int, err error) error {
+	if attempt >= attempts || ctx.Err() != nil || !isTransient(err) {
+		return err
+	}
+	wait, ok := c.retry.backoff(attempt, err)
+	if !ok {
+		return err
+	}
+	return sleepContext(ctx, wait)
+}
+
+// restart empties a partially downloaded file and its running hash, so the download can start again from the beginning
+func restart(f *os.File, h hash.Hash) (offset int64, err error) {
+	h.Reset()
+	if err = f.Truncate(0); err != nil {
+		return
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return
+}
+
+// downloadCached returns the cached copy of the database file of a commit, downloading it into the cache first if
+// needed
+func (c Connection) downloadCached(ctx context.Context, dbOwner, dbName, commitID string, entry DBTreeEntry) (db io.ReadCloser, err error) {
+	var f *os.File
+	f, err = c.cache.open(entry)
+	if err == nil && f == nil {
+		f, err = c.cache.add(entry, func(f *os.File) error {
+			return c.downloadCommit(ctx, dbOwner, dbName, commitID, entry, f)
+		})
+	}
+	if err != nil {
+		return
+	}
+	db = f
+	return
+}
+
+// resolveEntry works out which commit an identifier points to, returning it along with the tree entry of the
+// commit's database file
+func (c Connection) resolveEntry(ctx context.Context, dbOwner, dbName string, ident Identifier) (commitID string, entry DBTreeEntry, err error) {
+	if err = ident.validate(); err != nil {
+		return
+	}
+	var meta MetadataResponseContainer
+	meta, err = c.MetadataContext(ctx, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	commitID, err = resolveIdent(meta, ident)
+	if err != nil {
+		return
+	}
+	for _, e := range meta.Commits[commitID].Tree.Entries {
+		if e.EntryType == DATABASE {
+			entry = e
+			return
+		}
+	}
+	err = fmt.Errorf("commit '%s' doesn't have a database file", commitID)
+	return
+}
+
+// downloadCommit downloads the database file of a commit into w, checking its size and SHA256 on the way
+func (c Connection) downloadCommit(ctx context.Context, dbOwner, dbName, commitID string, entry DBTreeEntry, w io.Writer) (err error) {
+	// This goes straight to the server rather than through DownloadContext(), as it's also used to fill the cache
+	var resp *http.Response
+	resp, err = c.post(ctx, "/v1/download", c.PrepareVals(dbOwner, dbName, Identifier{CommitID: commitID}), nil)
+	if err != nil {
+		return
+	}
+	body := newProgressReadCloser(resp.Body, c.options().progress, "/v1/download", dbName, resp.ContentLength)
+	defer body.Close()
+
+	// Don't read more than one byte past the expected size, as that's enough to know the size is wrong
+	h := sha256.New()
+	var n int64
+	n, err = io.Copy(io.MultiWriter(w, h), io.LimitReader(body, entry.Size+1))
+	if err != nil {
+		return
+	}
+	return verify(commitID, entry, n, hex.EncodeToString(h.Sum(nil)))
+}
+
+// verify checks the size and SHA256 of downloaded data match the tree entry it was downloaded from
+func verify(commitID string, entry DBTreeEntry, size int64, sha string) error {
+	if size != entry.Size || !strings.EqualFold(sha, entry.Sha256) {
+		return &VerificationError{CommitID: commitID, ExpectedSize: entry.Size, ActualSize: size,
+			ExpectedSHA: entry.Sha256, ActualSHA: sha}
+	}
+	return nil
+}
+
+// tempFile is a temporary file which is removed when closed
+type tempFile struct {
+	*os.File
+}
+
+func (t tempFile) Close() error {
+	err := t.File.Close()
+	os.Remove(t.Name())
+	return err
+}
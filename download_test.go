@@ -0,0 +1,239 @@
+package dbhub_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// corruptingTransport changes the database files returned by the download end point
+type corruptingTransport struct {
+	change func(data []byte) []byte
+}
+
+func (c corruptingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil || req.URL.Path != "/v1/download" || c.change == nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	data = c.change(data)
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	return resp, nil
+}
+
+// newVerifyServer starts a test server holding the example database, with two commits on the main branch
+func newVerifyServer(t *testing.T, transport http.RoundTripper) (srv *dbhubtest.Server, conn dbhub.Connection,
+	dbBytes []byte, commit1, commit2 string) {
+	t.Helper()
+	srv = dbhubtest.NewServer()
+	t.Cleanup(srv.Close)
+	var opts []dbhub.Option
+	if transport != nil {
+		opts = append(opts, dbhub.WithTransport(transport))
+	}
+	conn, err := srv.Connection(dbhubtest.DefaultAPIKey, opts...)
+	require.NoError(t, err)
+
+	dbBytes, err = os.ReadFile(filepath.Join("examples", "upload", "example.db"))
+	require.NoError(t, err)
+	commit1, err = srv.AddDatabase(dbhubtest.DefaultUser, "example.db", dbBytes, dbhub.UploadInformation{})
+	require.NoError(t, err)
+
+	// The second commit changes the database, by making the file a little bigger
+	changed := append(append([]byte{}, dbBytes...), make([]byte, 4096)...)
+	commit2, err = srv.AddDatabase(dbhubtest.DefaultUser, "example.db", changed,
+		dbhub.UploadInformation{Ident: dbhub.Identifier{CommitID: commit1}})
+	require.NoError(t, err)
+	require.NoError(t, srv.AddTag(dbhubtest.DefaultUser, "example.db", "first", commit1, ""))
+	return
+}
+
+// TestDownloadToFile verifies downloading databases into files
+func TestDownloadToFile(t *testing.T) {
+	_, conn, dbBytes, commit1, commit2 := newVerifyServer(t, nil)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "example.db")
+
+	commitID, err := conn.DownloadToFile(ctx, dbhubtest.DefaultUser, "example.db", dbhub.Identifier{Tag: "first"}, path)
+	require.NoError(t, err)
+	assert.Equal(t, commit1, commitID)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, dbBytes, data)
+
+	// Downloading again replaces the file
+	commitID, err = conn.DownloadToFile(ctx, dbhubtest.DefaultUser, "example.db", dbhub.Identifier{}, path)
+	require.NoError(t, err)
+	assert.Equal(t, commit2, commitID)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(dbBytes)+4096), info.Size())
+
+	// Unknown identifiers are reported as missing
+	_, err = conn.DownloadToFile(ctx, dbhubtest.DefaultUser, "example.db", dbhub.Identifier{Tag: "missing"}, path)
+	assert.True(t, errors.Is(err, dbhub.ErrNotFound))
+
+	// Nothing else was left in the directory
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestDownloadVerified verifies downloaded databases are checked against their commit
+func TestDownloadVerified(t *testing.T) {
+	ctx := context.Background()
+	tr := &corruptingTransport{}
+	_, conn, dbBytes, commit1, _ := newVerifyServer(t, tr)
+
+	db, commitID, err := conn.DownloadVerified(ctx, dbhubtest.DefaultUser, "example.db",
+		dbhub.Identifier{CommitID: commit1})
+	require.NoError(t, err)
+	assert.Equal(t, commit1, commitID)
+	data, err := io.ReadAll(db)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	assert.Equal(t, dbBytes, data)
+
+	// A changed byte is caught by the SHA256 check
+	tr.change = func(data []byte) []byte {
+		data[100] ^= 0xff
+		return data
+	}
+	_, _, err = conn.DownloadVerified(ctx, dbhubtest.DefaultUser, "example.db", dbhub.Identifier{CommitID: commit1})
+	var verr *dbhub.VerificationError
+	require.True(t, errors.As(err, &verr))
+	assert.True(t, errors.Is(err, dbhub.ErrVerificationFailed))
+	assert.Equal(t, commit1, verr.CommitID)
+	assert.Equal(t, verr.ExpectedSize, verr.ActualSize)
+	assert.NotEqual(t, verr.ExpectedSHA, verr.ActualSHA)
+
+	// Extra data is caught by the size check, and the existing file is left alone
+	tr.change = func(data []byte) []byte {
+		return append(data, "extra"...)
+	}
+	path := filepath.Join(t.TempDir(), "example.db")
+	require.NoError(t, os.WriteFile(path, []byte("original"), 0644))
+	_, err = conn.DownloadToFile(ctx, dbhubtest.DefaultUser, "example.db", dbhub.Identifier{CommitID: commit1}, path)
+	require.True(t, errors.As(err, &verr))
+	assert.Equal(t, int64(len(dbBytes)), verr.ExpectedSize)
+	assert.Equal(t, int64(len(dbBytes)+1), verr.ActualSize)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data))
+}
+
+// rangeRecorder records the Range header sent with each download request, and the status code of the response
+type rangeRecorder struct {
+	mu       sync.Mutex
+	ranges   []string
+	statuses []int
+}
+
+func (r *rangeRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil && req.URL.Path == "/v1/download" {
+		r.mu.Lock()
+		r.ranges = append(r.ranges, req.Header.Get("Range"))
+		r.statuses = append(r.statuses, resp.StatusCode)
+		r.mu.Unlock()
+	}
+	return resp, err
+}
+
+// TestDownloadResume verifies interrupted downloads carry on from where they stopped
+func TestDownloadResume(t *testing.T) {
+	ctx := context.Background()
+	rec := &rangeRecorder{}
+	srv, conn, dbBytes, commit1, _ := newVerifyServer(t, rec)
+	ident := dbhub.Identifier{CommitID: commit1}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example.db")
+
+	// Without retries, the partial download is kept for the next call
+	srv.Script("/v1/download", dbhubtest.Fault{Truncate: 1000})
+	_, err := conn.DownloadToFile(ctx, dbhubtest.DefaultUser, "example.db", ident, path)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "unexpected error: %v", err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	info, err := entries[0].Info()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), info.Size())
+
+	_, err = conn.DownloadToFile(ctx, dbhubtest.DefaultUser, "example.db", ident, path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "bytes=1000-"}, rec.ranges)
+	assert.Equal(t, []int{http.StatusOK, http.StatusPartialContent}, rec.statuses)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, dbBytes, data)
+
+	// With retries, the download resumes straight away
+	require.NoError(t, os.Remove(path))
+	rec.ranges, rec.statuses = nil, nil
+	retrying, err := srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithTransport(rec),
+		dbhub.WithRetryPolicy(dbhub.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}))
+	require.NoError(t, err)
+	srv.Script("/v1/download", dbhubtest.Fault{Truncate: 2000})
+	_, err = retrying.DownloadToFile(ctx, dbhubtest.DefaultUser, "example.db", ident, path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "bytes=2000-"}, rec.ranges)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, dbBytes, data)
+
+	// Servers which ignore the Range header send the whole database again, which replaces the partial data
+	require.NoError(t, os.Remove(path))
+	rec.ranges, rec.statuses = nil, nil
+	srv.Script("/v1/download", dbhubtest.Fault{Truncate: 1000}, dbhubtest.Fault{IgnoreRange: true})
+	_, err = conn.DownloadToFile(ctx, dbhubtest.DefaultUser, "example.db", ident, path)
+	require.Error(t, err)
+	_, err = conn.DownloadToFile(ctx, dbhubtest.DefaultUser, "example.db", ident, path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "bytes=1000-"}, rec.ranges)
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK}, rec.statuses)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, dbBytes, data)
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestDownloadRetryBudget verifies failed requests and broken off downloads share the one retry budget
+func TestDownloadRetryBudget(t *testing.T) {
+	rec := &rangeRecorder{}
+	srv, _, _, commit1, _ := newVerifyServer(t, rec)
+	conn, err := srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithTransport(rec),
+		dbhub.WithRetryPolicy(dbhub.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "example.db")
+
+	// Three attempts are made in total, and then the download gives up
+	srv.Script("/v1/download", dbhubtest.Fault{Truncate: 1000}, dbhubtest.Fault{Status: http.StatusServiceUnavailable},
+		dbhubtest.Fault{Status: http.StatusServiceUnavailable}, dbhubtest.Fault{Status: http.StatusServiceUnavailable})
+	_, err = conn.DownloadToFile(context.Background(), dbhubtest.DefaultUser, "example.db",
+		dbhub.Identifier{CommitID: commit1}, path)
+	var apiErr *dbhub.APIError
+	require.True(t, errors.As(err, &apiErr), "unexpected error: %v", err)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.Equal(t, []string{"", "bytes=1000-", "bytes=1000-"}, rec.ranges)
+}
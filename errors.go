@@ -0,0 +1,144 @@
+package dbhub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxErrorBody is the largest amount of an error response body which is kept in an APIError
+const maxErrorBody = 64 * 1024
+
+var (
+	// ErrNotFound is matched by API errors for databases, tables, or other objects which don't exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrUnauthorized is matched by API errors caused by a missing or invalid API key, or a lack of access rights
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrRateLimited is matched by API errors returned when the server is throttling requests
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrConflict is matched by API errors caused by a conflicting change, eg uploading onto an outdated commit
+	ErrConflict = errors.New("conflict")
+
+	// ErrVerificationFailed is matched by a VerificationError, returned when a downloaded database doesn't match the
+	// size or SHA256 recorded in its commit
+	ErrVerificationFailed = errors.New("downloaded database failed verification")
+
+	// ErrPinMismatch is returned when the server's certificate doesn't hold any of the keys given to WithPinnedKeys()
+	ErrPinMismatch = errors.New("the server certificate doesn't match any of the pinned keys")
+
+	// ErrAmbiguousIdentifier is returned when an Identifier names more than one of a branch, commit, release, and tag
+	ErrAmbiguousIdentifier = errors.New("ambiguous identifier")
+)
+
+// APIError is returned when the DBHub.io server responds to a request with an error status.  It can be matched against
+// ErrNotFound, ErrUnauthorized, ErrRateLimited, and ErrConflict using errors.Is().
+type APIError struct {
+	StatusCode int    // The http status code returned by the server
+	Status     string // The http status line returned by the server, eg "404 Not Found"
+	Endpoint   string // The API end point which was called, eg "/v1/query"
+	Msg        string // The error message provided by the server, if there was one
+	Body       []byte // The raw response body, truncated if it was very large
+
+	// RetryAfter is how long the server asked us to wait before trying again, if it sent a Retry-After header
+	RetryAfter time.Duration
+
+	// cause is the sentinel error this error matches, if any
+	cause error
+}
+
+// Error returns the message provided by the server, falling back to the http status when there isn't one
+func (e *APIError) Error() string {
+	if e.Msg != "" {
+		return e.Msg
+	}
+	return e.Status
+}
+
+// Unwrap returns the sentinel error matching the cause of the failure, so errors.Is() works with the API errors
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+// lookupEndpoints holds the API end points which look up a database, commit, or branch.  A failed row lookup reported
+// by one of these means the object doesn't exist, whereas from other end points (eg "/v1/query") it could be caused
+// by something else.
+var lookupEndpoints = map[string]bool{
+	"/v1/branches": true,
+	"/v1/columns":  true,
+	"/v1/commits":  true,
+	"/v1/delete":   true,
+	"/v1/diff":     true,
+	"/v1/download": true,
+	"/v1/indexes":  true,
+	"/v1/metadata": true,
+	"/v1/releases": true,
+	"/v1/tables":   true,
+	"/v1/tags":     true,
+	"/v1/views":    true,
+	"/v1/webpage":  true,
+}
+
+// newAPIError creates an APIError from an unsuccessful server response.  The response body is read and closed.
+func newAPIError(endpoint string, resp *http.Response) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Endpoint:   endpoint,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	e.Body, _ = io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body.Close()
+
+	// If there's useful error info in the returned JSON, use that as the error message
+	var z JSONError
+	if json.Unmarshal(e.Body, &z) == nil {
+		e.Msg = z.Msg
+	}
+
+	// Work out which of the sentinel errors (if any) this matches
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		e.cause = ErrNotFound
+	case e.Msg == "no rows in result set" && lookupEndpoints[endpoint]:
+		// The server reports some missing objects (eg when deleting a database) as a failed row lookup
+		e.cause = ErrNotFound
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		e.cause = ErrUnauthorized
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.cause = ErrRateLimited
+	case resp.StatusCode == http.StatusConflict:
+		e.cause = ErrConflict
+	}
+	return e
+}
+
+// VerificationError is returned when a downloaded database doesn't match the details recorded in its commit.  It
+// matches ErrVerificationFailed using errors.Is().
+type VerificationError struct {
+	CommitID     string // The commit the database was downloaded from
+	ExpectedSize int64  // The size recorded in the commit
+	ActualSize   int64  // The size of the downloaded data, which stops one byte past ExpectedSize if it's too big
+	ExpectedSHA  string // The SHA256 recorded in the commit
+	ActualSHA    string // The SHA256 of the downloaded data
+}
+
+// Error describes which of the checks failed
+func (e *VerificationError) Error() string {
+	if e.ExpectedSize != e.ActualSize {
+		return fmt.Sprintf("downloaded database from commit '%s' is the wrong size, it should be %d bytes",
+			e.CommitID, e.ExpectedSize)
+	}
+	return fmt.Sprintf("downloaded database from commit '%s' has SHA256 %s, but should have %s", e.CommitID,
+		e.ActualSHA, e.ExpectedSHA)
+}
+
+// Unwrap returns ErrVerificationFailed, so errors.Is() works with verification errors
+func (e *VerificationError) Unwrap() error {
+	return ErrVerificationFailed
+}
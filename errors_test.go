@@ -0,0 +1,78 @@
+package dbhub
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAPIError verifies error responses from the server are returned as APIError values, matching the sentinel errors
+func TestAPIError(t *testing.T) {
+	// Create a test server which returns a different error for each end point
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/tables":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Database not found"}`))
+		case "/v1/views":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Incorrect or unknown API key and certificate"}`))
+		case "/v1/indexes":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/v1/delete", "/v1/query":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"no rows in result set"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`<html><body>Bad Gateway</body></html>`))
+		}
+	}))
+	defer srv.Close()
+	conn, err := New("somekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	// A missing database
+	_, err = conn.Tables("default", "missing.sqlite", Identifier{})
+	var apiErr *APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.Equal(t, "/v1/tables", apiErr.Endpoint)
+		assert.Equal(t, "Database not found", apiErr.Msg)
+		assert.Equal(t, "Database not found", err.Error())
+	}
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// An invalid API key
+	_, err = conn.Views("default", "some.sqlite", Identifier{})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.NotErrorIs(t, err, ErrNotFound)
+
+	// Throttling, without any error message in the body
+	_, err = conn.Indexes("default", "some.sqlite", Identifier{})
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, "429 Too Many Requests", err.Error())
+
+	// Deleting a missing database
+	err = conn.Delete("missing.sqlite")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, "Unknown database", err.Error())
+
+	// The same message from an end point which doesn't look up a database isn't taken to mean it's missing
+	_, err = conn.Query("default", "some.sqlite", Identifier{}, false, "SELECT * FROM table1")
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, "no rows in result set", err.Error())
+
+	// A non JSON error page
+	_, err = conn.Columns("default", "some.sqlite", Identifier{}, "table1")
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+		assert.Empty(t, apiErr.Msg)
+		assert.Equal(t, "<html><body>Bad Gateway</body></html>", string(apiErr.Body))
+	}
+}
@@ -0,0 +1,287 @@
+package dbhub
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CommitGraph is the commit history of a database, along with its branches, tags, and releases.  It links each commit
+// to its parents and children, so the history can be walked in either direction.
+type CommitGraph struct {
+	Commits       map[string]CommitEntry
+	Branches      map[string]BranchEntry
+	Tags          map[string]TagEntry
+	Releases      map[string]ReleaseEntry
+	DefaultBranch string
+
+	// children holds the IDs of the commits which have each commit as a parent
+	children map[string][]string
+}
+
+// CommitGraph returns the commit history of a database
+func (c Connection) CommitGraph(dbOwner, dbName string) (graph *CommitGraph, err error) {
+	return c.CommitGraphContext(context.Background(), dbOwner, dbName)
+}
+
+// CommitGraphContext is like CommitGraph, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) CommitGraphContext(ctx context.Context, dbOwner, dbName string) (graph *CommitGraph, err error) {
+	var meta MetadataResponseContainer
+	meta, err = c.MetadataContext(ctx, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	graph = NewCommitGraph(meta)
+	return
+}
+
+// NewCommitGraph builds the commit graph of a database from its metadata.  To build one from the result of Commits(),
+// use NewCommitGraph(dbhub.MetadataResponseContainer{Commits: commits}).
+func NewCommitGraph(meta MetadataResponseContainer) *CommitGraph {
+	g := &CommitGraph{
+		Commits:       meta.Commits,
+		Branches:      meta.Branches,
+		Tags:          meta.Tags,
+		Releases:      meta.Releases,
+		DefaultBranch: meta.DefBranch,
+		children:      make(map[string][]string),
+	}
+	if g.Commits == nil {
+		g.Commits = make(map[string]CommitEntry)
+	}
+	for id := range g.Commits {
+		for _, p := range g.Parents(id) {
+			g.children[p] = append(g.children[p], id)
+		}
+	}
+	return g
+}
+
+// Resolve returns the ID of the commit an identifier points to, in the same way as Connection.Resolve()
+func (g *CommitGraph) Resolve(ident Identifier) (string, error) {
+	return resolveIdent(MetadataResponseContainer{Branches: g.Branches, Commits: g.Commits, DefBranch: g.DefaultBranch,
+		Releases: g.Releases, Tags: g.Tags}, ident)
+}
+
+// Parents returns the IDs of the parents of a commit, first parent first.  Parents which aren't in the graph are left
+// out, as are repeats of the same parent.
+func (g *CommitGraph) Parents(commitID string) (parents []string) {
+	c := g.Commits[commitID]
+	for _, p := range append([]string{c.Parent}, c.OtherParents...) {
+		if _, ok := g.Commits[p]; ok && indexOf(parents, p) < 0 {
+			parents = append(parents, p)
+		}
+	}
+	return
+}
+
+// Children returns the IDs of the commits which have the given commit as a parent
+func (g *CommitGraph) Children(commitID string) []string {
+	return append([]string(nil), g.children[commitID]...)
+}
+
+// LogOptions chooses the commits returned by CommitGraph.Log().  The zero LogOptions returns every commit.
+type LogOptions struct {
+	// Heads limits the log to these commits and their ancestors.  When empty, all commits are included.
+	Heads []string
+
+	// Exclude leaves out these commits and their ancestors, eg to list the commits on a branch since a tag
+	Exclude []string
+
+	// Author only includes commits whose author name or email contains this text, ignoring case
+	Author string
+
+	// Since and Until only include commits made in this time range.  Either can be left as the zero time.
+	Since time.Time
+	Until time.Time
+
+	// Message only includes commits whose message contains this text, ignoring case
+	Message string
+}
+
+// Log returns commits in topological order, newest first.  Every commit comes before its parents, and commits which
+// could go in either order are sorted by their timestamp.  Heads and Exclude must be commit IDs in the graph, which
+// Resolve() can be used to find.
+func (g *CommitGraph) Log(opts LogOptions) (log []CommitEntry, err error) {
+	var include, exclude map[string]bool
+	if len(opts.Heads) > 0 {
+		if include, err = g.ancestors(opts.Heads...); err != nil {
+			return
+		}
+	}
+	if len(opts.Exclude) > 0 {
+		if exclude, err = g.ancestors(opts.Exclude...); err != nil {
+			return
+		}
+	}
+	author, message := strings.ToLower(opts.Author), strings.ToLower(opts.Message)
+	for _, id := range g.topoSort() {
+		c := g.Commits[id]
+		switch {
+		case include != nil && !include[id], exclude[id]:
+		case author != "" && !strings.Contains(strings.ToLower(c.AuthorName), author) &&
+			!strings.Contains(strings.ToLower(c.AuthorEmail), author):
+		case !opts.Since.IsZero() && c.Timestamp.Before(opts.Since):
+		case !opts.Until.IsZero() && c.Timestamp.After(opts.Until):
+		case message != "" && !strings.Contains(strings.ToLower(c.Message), message):
+		default:
+			log = append(log, c)
+		}
+	}
+	return
+}
+
+// IsAncestor returns true if ancestor is reachable by following the parents of commitID.  A commit counts as its own
+// ancestor.
+func (g *CommitGraph) IsAncestor(ancestor, commitID string) (bool, error) {
+	if err := g.check(ancestor); err != nil {
+		return false, err
+	}
+	seen, err := g.ancestors(commitID)
+	if err != nil {
+		return false, err
+	}
+	return seen[ancestor], nil
+}
+
+// MergeBase returns the best common ancestor of two commits, ie the one which isn't an ancestor of any other common
+// ancestor.  If there's more than one of those (eg after criss-cross merges), the newest is returned.  If the commits
+// don't have any history in common, the error matches ErrNotFound.
+func (g *CommitGraph) MergeBase(a, b string) (commitID string, err error) {
+	var ancestorsA, ancestorsB map[string]bool
+	if ancestorsA, err = g.ancestors(a); err != nil {
+		return
+	}
+	if ancestorsB, err = g.ancestors(b); err != nil {
+		return
+	}
+
+	// In topological order, the first common ancestor can't be the ancestor of another common ancestor.  Ties are
+	// sorted newest first, so it's also the newest of the best ones.
+	for _, id := range g.topoSort() {
+		if ancestorsA[id] && ancestorsB[id] {
+			commitID = id
+			return
+		}
+	}
+	err = fmt.Errorf("commits '%s' and '%s' don't have a common ancestor: %w", a, b, ErrNotFound)
+	return
+}
+
+// AheadBehind counts the commits reachable from a but not from b (ahead), and the ones reachable from b but not from
+// a (behind).  Comparing two branch heads gives the same figures as "git rev-list --left-right --count a...b".
+func (g *CommitGraph) AheadBehind(a, b string) (ahead, behind int, err error) {
+	var ancestorsA, ancestorsB map[string]bool
+	if ancestorsA, err = g.ancestors(a); err != nil {
+		return
+	}
+	if ancestorsB, err = g.ancestors(b); err != nil {
+		return
+	}
+	for id := range ancestorsA {
+		if !ancestorsB[id] {
+			ahead++
+		}
+	}
+	for id := range ancestorsB {
+		if !ancestorsA[id] {
+			behind++
+		}
+	}
+	return
+}
+
+// check returns an error matching ErrNotFound if a commit isn't in the graph
+func (g *CommitGraph) check(commitID string) error {
+	if _, ok := g.Commits[commitID]; !ok {
+		return fmt.Errorf("commit '%s' doesn't exist: %w", commitID, ErrNotFound)
+	}
+	return nil
+}
+
+// ancestors returns the set of commits reachable from the given ones, including themselves
+func (g *CommitGraph) ancestors(commitIDs ...string) (seen map[string]bool, err error) {
+	seen = make(map[string]bool)
+	var todo []string
+	for _, id := range commitIDs {
+		if err = g.check(id); err != nil {
+			return
+		}
+		todo = append(todo, id)
+	}
+	for len(todo) > 0 {
+		id := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		todo = append(todo, g.Parents(id)...)
+	}
+	return
+}
+
+// topoSort returns the IDs of all the commits with children before their parents, and the newest first otherwise
+func (g *CommitGraph) topoSort() []string {
+	// Count the children of each commit still to be output, starting with the commits which don't have any
+	pending := make(map[string]int, len(g.Commits))
+	ready := &commitHeap{g: g}
+	for id := range g.Commits {
+		pending[id] = len(g.children[id])
+		if pending[id] == 0 {
+			ready.ids = append(ready.ids, id)
+		}
+	}
+	heap.Init(ready)
+	ids := make([]string, 0, len(g.Commits))
+	for ready.Len() > 0 {
+		id := heap.Pop(ready).(string)
+		ids = append(ids, id)
+
+		for _, p := range g.Parents(id) {
+			if pending[p]--; pending[p] == 0 {
+				heap.Push(ready, p)
+			}
+		}
+	}
+	return ids
+}
+
+// indexOf returns the position of a string in a slice, or -1 if it isn't there
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// commitHeap is a heap of commit IDs, newest commit first.  Commits with the same timestamp are sorted by ID so the
+// order is always the same.
+type commitHeap struct {
+	g   *CommitGraph
+	ids []string
+}
+
+func (h *commitHeap) Len() int { return len(h.ids) }
+
+func (h *commitHeap) Less(i, j int) bool {
+	a, b := h.g.Commits[h.ids[i]], h.g.Commits[h.ids[j]]
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.After(b.Timestamp)
+	}
+	return h.ids[i] < h.ids[j]
+}
+
+func (h *commitHeap) Swap(i, j int) { h.ids[i], h.ids[j] = h.ids[j], h.ids[i] }
+
+func (h *commitHeap) Push(x interface{}) { h.ids = append(h.ids, x.(string)) }
+
+func (h *commitHeap) Pop() interface{} {
+	id := h.ids[len(h.ids)-1]
+	h.ids = h.ids[:len(h.ids)-1]
+	return id
+}
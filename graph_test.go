@@ -0,0 +1,147 @@
+package dbhub_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testGraph returns a commit graph with a feature branch merged back into main:
+//
+//	A - B - C ---- M   main
+//	     \        /
+//	      D ---- E     feature
+func testGraph() *dbhub.CommitGraph {
+	start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	commit := func(id string, hours int, author, msg, parent string, others ...string) dbhub.CommitEntry {
+		return dbhub.CommitEntry{ID: id, AuthorName: author, AuthorEmail: author + "@example.org", Message: msg,
+			Parent: parent, OtherParents: others, Timestamp: start.Add(time.Duration(hours) * time.Hour)}
+	}
+	return dbhub.NewCommitGraph(dbhub.MetadataResponseContainer{
+		Commits: map[string]dbhub.CommitEntry{
+			"A": commit("A", 0, "alice", "Initial commit", ""),
+			"B": commit("B", 1, "alice", "Add the users table", "A"),
+			"C": commit("C", 2, "bob", "Fix a typo", "B"),
+			"D": commit("D", 3, "carol", "Start the new feature", "B"),
+			"E": commit("E", 4, "carol", "Finish the new FEATURE", "D"),
+			"M": commit("M", 5, "bob", "Merge feature into main", "C", "E"),
+		},
+		Branches:  map[string]dbhub.BranchEntry{"main": {Commit: "M"}, "feature": {Commit: "E"}},
+		Tags:      map[string]dbhub.TagEntry{"v1": {Commit: "B"}},
+		DefBranch: "main",
+	})
+}
+
+// ids returns the IDs of a list of commits
+func ids(commits []dbhub.CommitEntry) (list []string) {
+	for _, c := range commits {
+		list = append(list, c.ID)
+	}
+	return
+}
+
+// TestCommitGraphLog verifies commits are listed in topological order, and filtered
+func TestCommitGraphLog(t *testing.T) {
+	g := testGraph()
+	log, err := g.Log(dbhub.LogOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"M", "E", "D", "C", "B", "A"}, ids(log))
+	assert.Equal(t, []string{"C", "E"}, g.Parents("M"))
+	assert.ElementsMatch(t, []string{"C", "D"}, g.Children("B"))
+
+	// What changed on the feature branch since tag v1
+	feature, err := g.Resolve(dbhub.Identifier{Branch: "feature"})
+	require.NoError(t, err)
+	v1, err := g.Resolve(dbhub.Identifier{Tag: "v1"})
+	require.NoError(t, err)
+	log, err = g.Log(dbhub.LogOptions{Heads: []string{feature}, Exclude: []string{v1}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"E", "D"}, ids(log))
+
+	start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		opts dbhub.LogOptions
+		want []string
+	}{
+		{dbhub.LogOptions{Author: "ALICE"}, []string{"B", "A"}},
+		{dbhub.LogOptions{Author: "bob@example"}, []string{"M", "C"}},
+		{dbhub.LogOptions{Message: "feature"}, []string{"M", "E", "D"}},
+		{dbhub.LogOptions{Since: start.Add(2 * time.Hour), Until: start.Add(4 * time.Hour)}, []string{"E", "D", "C"}},
+		{dbhub.LogOptions{Heads: []string{"C"}, Author: "alice"}, []string{"B", "A"}},
+		{dbhub.LogOptions{Message: "nothing matches this"}, nil},
+	}
+	for _, tt := range tests {
+		log, err = g.Log(tt.opts)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, ids(log), "%+v", tt.opts)
+	}
+
+	_, err = g.Log(dbhub.LogOptions{Heads: []string{"Z"}})
+	assert.ErrorIs(t, err, dbhub.ErrNotFound)
+}
+
+// TestCommitGraphAncestry verifies the ancestry checks, merge base, and ahead/behind counts
+func TestCommitGraphAncestry(t *testing.T) {
+	g := testGraph()
+	for _, tt := range []struct {
+		ancestor, commit string
+		want             bool
+	}{
+		{"B", "M", true},
+		{"E", "M", true},
+		{"C", "C", true},
+		{"D", "C", false},
+		{"M", "A", false},
+	} {
+		ok, err := g.IsAncestor(tt.ancestor, tt.commit)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, ok, "%s %s", tt.ancestor, tt.commit)
+	}
+
+	base, err := g.MergeBase("C", "E")
+	require.NoError(t, err)
+	assert.Equal(t, "B", base)
+	base, err = g.MergeBase("M", "E")
+	require.NoError(t, err)
+	assert.Equal(t, "E", base)
+
+	ahead, behind, err := g.AheadBehind("C", "E")
+	require.NoError(t, err)
+	assert.Equal(t, 1, ahead)
+	assert.Equal(t, 2, behind)
+	ahead, behind, err = g.AheadBehind("M", "E")
+	require.NoError(t, err)
+	assert.Equal(t, 2, ahead)
+	assert.Equal(t, 0, behind)
+
+	_, err = g.IsAncestor("Z", "M")
+	assert.ErrorIs(t, err, dbhub.ErrNotFound)
+	_, _, err = g.AheadBehind("M", "Z")
+	assert.ErrorIs(t, err, dbhub.ErrNotFound)
+
+	// Unrelated histories don't have a merge base
+	g.Commits["X"] = dbhub.CommitEntry{ID: "X"}
+	g = dbhub.NewCommitGraph(dbhub.MetadataResponseContainer{Commits: g.Commits})
+	_, err = g.MergeBase("X", "M")
+	assert.ErrorIs(t, err, dbhub.ErrNotFound)
+}
+
+// TestCommitGraphFromServer verifies the commit graph of a database can be fetched
+func TestCommitGraphFromServer(t *testing.T) {
+	_, conn, _, commit1, commit2 := newVerifyServer(t, nil)
+	g, err := conn.CommitGraph(dbhubtest.DefaultUser, "example.db")
+	require.NoError(t, err)
+	first, err := g.Resolve(dbhub.Identifier{Tag: "first"})
+	require.NoError(t, err)
+	assert.Equal(t, commit1, first)
+	ok, err := g.IsAncestor(commit1, commit2)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	log, err := g.Log(dbhub.LogOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{commit2, commit1}, ids(log))
+}
@@ -2,36 +2,27 @@ package dbhub
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
-// sendRequestJSON sends a request to DBHub.io, formatting the returned result as JSON
-func sendRequestJSON(queryUrl string, verifyServerCert bool, data url.Values, returnStructure interface{}) (err error) {
+// sendRequestJSON sends a request to DBHub.io, formatting the returned result as JSON.  The request is cancelled if
+// ctx is done before it completes
+func (c Connection) sendRequestJSON(ctx context.Context, endpoint string, data url.Values, returnStructure interface{}) (err error) {
 	// Send the request
 	var body io.ReadCloser
-	body, err = sendRequest(queryUrl, verifyServerCert, data)
-	if body != nil {
-		defer body.Close()
-	}
+	body, err = c.sendRequest(ctx, endpoint, data)
 	if err != nil {
-		if body != nil {
-			// If there's useful error info in the returned JSON, return that as the error message
-			var z JSONError
-			err = json.NewDecoder(body).Decode(&z)
-			if err != nil {
-				return
-			}
-			err = fmt.Errorf("%s", z.Msg)
-		}
 		return
 	}
+	defer body.Close()
 
 	// Unmarshall the JSON response into the structure provided by the caller
 	if returnStructure != nil {
@@ -44,113 +35,130 @@ func sendRequestJSON(queryUrl string, verifyServerCert bool, data url.Values, re
 }
 
 // sendRequest sends a request to DBHub.io.  It exists because http.PostForm() doesn't seem to have a way of changing
-// header values.
-func sendRequest(queryUrl string, verifyServerCert bool, data url.Values) (body io.ReadCloser, err error) {
-	// Disable verification of the server https cert, if we've been told to
-	var client http.Client
-	if !verifyServerCert {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client = http.Client{Transport: tr}
-	}
-
-	var req *http.Request
+// header values.  If the server responds with an error status, the returned error is an *APIError.
+func (c Connection) sendRequest(ctx context.Context, endpoint string, data url.Values) (body io.ReadCloser, err error) {
 	var resp *http.Response
-	req, err = http.NewRequest(http.MethodPost, queryUrl, strings.NewReader(data.Encode()))
-	if err != nil {
-		return
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", fmt.Sprintf("go-dbhub v%s", version))
-	resp, err = client.Do(req)
+	resp, err = c.post(ctx, endpoint, data, nil)
 	if err != nil {
 		return
 	}
-
-	// Return the response body, even if an error occurred.  This lets us return useful error information provided as
-	// JSON in the body of the message
 	body = resp.Body
+	return
+}
 
-	// Basic error handling, based on the status code received from the server
-	if resp.StatusCode != 200 {
-		// The returned status code indicates something went wrong
-		err = fmt.Errorf(resp.Status)
+// post sends a form encoded request to DBHub.io with any extra headers given, returning the successful response
+func (c Connection) post(ctx context.Context, endpoint string, data url.Values, header http.Header) (resp *http.Response, err error) {
+	form := data.Encode()
+	return c.do(ctx, endpoint, data, http.StatusOK, func() (req *http.Request, err error) {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.Server+endpoint, strings.NewReader(form))
+		if err != nil {
+			return
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		return
-	}
-	return
+	})
 }
 
 // sendUpload uploads a database to DBHub.io.  It exists because the DBHub.io upload end point requires multi-part data
-func sendUpload(queryUrl string, verifyServerCert bool, data *url.Values, dbBytes *[]byte) (body io.ReadCloser, err error) {
-	// Prepare the database file byte stream
-	var buf bytes.Buffer
-	w := multipart.NewWriter(&buf)
-	dbName := data.Get("dbname")
-	var wri io.Writer
-	if dbName != "" {
-		wri, err = w.CreateFormFile("file", dbName)
-	} else {
-		wri, err = w.CreateFormFile("file", "database.db")
-	}
-	if err != nil {
-		return
-	}
-	_, err = wri.Write(*dbBytes)
-	if err != nil {
-		return
-	}
+func (c Connection) sendUpload(ctx context.Context, endpoint string, data url.Values, dbBytes *[]byte) (body io.ReadCloser, err error) {
+	body, _, err = c.sendUploadStream(ctx, endpoint, data, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(*dbBytes)), nil
+	}, int64(len(*dbBytes)), false)
+	return
+}
 
-	// Add the headers
-	for i, j := range *data {
-		wri, err = w.CreateFormField(i)
-		if err != nil {
+// do sends a request to DBHub.io, retrying it if needed according to the retry policy of the connection.  newRequest
+// is called to create a fresh request for each attempt, and data holds the form values it sends, for the connection's
+// interceptors.  If the server responds with a status code other than wantStatus, the returned error is an *APIError
+// holding any useful error information provided by the server.
+func (c Connection) do(ctx context.Context, endpoint string, data url.Values, wantStatus int, newRequest func() (*http.Request, error)) (resp *http.Response, err error) {
+	attempts := c.retry.attempts(endpoint)
+	for attempt := 1; ; attempt++ {
+		req, reqErr := newRequest()
+		if reqErr != nil {
+			// When the request body can't be sent again, the error from the previous attempt is the useful one
+			if attempt == 1 || !errors.Is(reqErr, errNotRewindable) {
+				err = reqErr
+			}
 			return
 		}
-		_, err = wri.Write([]byte(j[0]))
+		req.Header.Set("User-Agent", fmt.Sprintf("go-dbhub v%s", version))
+		var x *Exchange
+		x, err = c.beforeRequest(ctx, endpoint, data, req, attempt)
+
+		// Wait until the client side limits allow the request to be sent
+		var release func()
+		if err == nil {
+			if release, err = c.limiter.acquire(ctx); err != nil {
+				c.onError(ctx, x, err)
+			}
+		}
 		if err != nil {
+			// Streamed request bodies are fed by a goroutine, which needs to be told the body won't be read
+			if req.Body != nil {
+				req.Body.Close()
+			}
 			return
 		}
-	}
-	err = w.Close()
-	if err != nil {
-		return
-	}
+		start := time.Now()
+		resp, err = c.client().Do(req)
+		if err != nil {
+			release()
+		}
+		x.received(resp, start)
+		if err == nil {
+			// Partial content is only sent in response to Range requests, which want it
+			if resp.StatusCode == wantStatus || (wantStatus == http.StatusOK && resp.StatusCode == http.StatusPartialContent) {
+				c.limiter.succeeded()
+				c.afterResponse(ctx, x, resp)
 
-	// Disable verification of the server https cert, if we've been told to
-	var client http.Client
-	if !verifyServerCert {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				// The concurrency slot is kept until the caller has finished with the response body
+				resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+				return
+			}
+			apiErr := newAPIError(endpoint, resp)
+			release()
+			if apiErr.StatusCode == http.StatusTooManyRequests {
+				c.limiter.throttled(apiErr.RetryAfter, c.retry.MaxBackoff)
+			}
+			err = apiErr
+			resp = nil
 		}
-		client = http.Client{Transport: tr}
-	}
+		c.onError(ctx, x, err)
 
-	// Prepare the request
-	var req *http.Request
-	var resp *http.Response
-	req, err = http.NewRequest(http.MethodPost, queryUrl, &buf)
-	if err != nil {
-		return
+		// Give up if the error isn't likely to go away, we're out of attempts, or the server wants us to wait too long
+		if attempt >= attempts || ctx.Err() != nil || !isTransient(err) {
+			return
+		}
+		wait, ok := c.retry.backoff(attempt, err)
+		if !ok {
+			return
+		}
+		if waitErr := sleepContext(ctx, wait); waitErr != nil {
+			err = waitErr
+			return
+		}
 	}
-	req.Header.Set("User-Agent", fmt.Sprintf("go-dbhub v%s", version))
-	req.Header.Set("Content-Type", w.FormDataContentType())
+}
 
-	// Upload the database
-	resp, err = client.Do(req)
-	if err != nil {
-		return
+// client returns the http.Client used for requests by this connection
+func (c Connection) client() *http.Client {
+	if c.httpClient != nil {
+		return c.httpClient
+	}
+	if c.tls != nil {
+		if c.VerifyServerCert {
+			return c.tls.verify
+		}
+		return c.tls.insecure
 	}
 
-	// Return the response body, even if an error occurred.  This lets us return useful error information provided as
-	// JSON in the body of the message
-	body = resp.Body
-
-	// Basic error handling, based on the status code received from the server
-	if resp.StatusCode != 201 {
-		// The returned status code indicates something went wrong
-		err = fmt.Errorf(resp.Status)
-		return
+	// Otherwise use one of the package level clients, which keep a pool of server connections open for reuse
+	if c.VerifyServerCert {
+		return defaultClient
 	}
-	return
+	return insecureClient
 }
@@ -0,0 +1,157 @@
+package dbhub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RedactedAPIKey replaces the API key in the form values given to interceptors, so they can be logged safely
+const RedactedAPIKey = "REDACTED"
+
+// Interceptor holds hooks called around each attempt at sending a request to the server.  They can be used for audit
+// logging, adding headers such as request IDs, or checking the requests made in tests.  Any of the hooks can be nil.
+type Interceptor struct {
+	// BeforeRequest is called before each attempt, including retries.  Changes it makes to Exchange.Header are sent
+	// with the request.  Returning an error stops the request, and the error is returned to the caller without OnError
+	// being called.
+	BeforeRequest func(ctx context.Context, x *Exchange) error
+
+	// AfterResponse is called after a successful response, once its body has been closed
+	AfterResponse func(ctx context.Context, x *Exchange)
+
+	// OnError is called when an attempt fails, either due to a connection problem or an error status from the server.
+	// Attempts which are retried are included.
+	OnError func(ctx context.Context, x *Exchange, err error)
+}
+
+// Exchange describes one attempt at sending a request to the server, as seen by an Interceptor
+type Exchange struct {
+	Endpoint string      // The API end point, eg "/v1/query"
+	Form     url.Values  // The form values sent, with the API key redacted.  Uploaded databases aren't included.
+	Header   http.Header // The request headers, which BeforeRequest hooks can change
+	Attempt  int         // The attempt number, starting from 1 and counting up with each retry
+
+	// These are filled in once the server has responded
+	StatusCode    int           // The http status code of the response, or 0 if there wasn't one
+	Latency       time.Duration // The time from sending the request until the response headers arrived
+	BytesSent     int64         // The size of the request body sent
+	BytesReceived int64         // The size of the response body read
+
+	sent *int64
+}
+
+// WithInterceptor adds an interceptor to the connection.  When there are several, their BeforeRequest hooks are called
+// in the order they were added, and their AfterResponse and OnError hooks in the reverse order.
+func WithInterceptor(i Interceptor) Option {
+	return func(c *Connection) error {
+		if i.BeforeRequest == nil && i.AfterResponse == nil && i.OnError == nil {
+			return fmt.Errorf("the interceptor has no hooks")
+		}
+		// The list is copied rather than added to in place, as copies of the Connection may share it
+		c.setOptions(func(o *connOptions) {
+			o.interceptors = append(o.interceptors[:len(o.interceptors):len(o.interceptors)], i)
+		})
+		return nil
+	}
+}
+
+// beforeRequest returns the details of a request about to be sent, after calling the BeforeRequest hooks.  nil is
+// returned if there aren't any interceptors.
+func (c Connection) beforeRequest(ctx context.Context, endpoint string, data url.Values, req *http.Request, attempt int) (x *Exchange, err error) {
+	if len(c.options().interceptors) == 0 {
+		return nil, nil
+	}
+	form := make(url.Values, len(data))
+	for k, v := range data {
+		form[k] = append([]string(nil), v...)
+	}
+	if form.Get("apikey") != "" {
+		form.Set("apikey", RedactedAPIKey)
+	}
+	x = &Exchange{Endpoint: endpoint, Form: form, Header: req.Header, Attempt: attempt, sent: new(int64)}
+	if req.Body != nil {
+		req.Body = &countingBody{ReadCloser: req.Body, n: x.sent}
+	}
+	for _, i := range c.options().interceptors {
+		if i.BeforeRequest == nil {
+			continue
+		}
+		if err = i.BeforeRequest(ctx, x); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// received records the arrival of a response.  The response body is wrapped so the bytes read from it are counted.
+func (x *Exchange) received(resp *http.Response, start time.Time) {
+	if x == nil {
+		return
+	}
+	x.Latency = time.Since(start)
+	if resp != nil {
+		x.StatusCode = resp.StatusCode
+		resp.Body = &countingBody{ReadCloser: resp.Body, n: &x.BytesReceived}
+	}
+}
+
+// afterResponse arranges for the AfterResponse hooks to be called once the response body is closed
+func (c Connection) afterResponse(ctx context.Context, x *Exchange, resp *http.Response) {
+	if x == nil {
+		return
+	}
+	resp.Body.(*countingBody).onClose = func() {
+		x.BytesSent = atomic.LoadInt64(x.sent)
+		interceptors := c.options().interceptors
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			if hook := interceptors[i].AfterResponse; hook != nil {
+				hook(ctx, x)
+			}
+		}
+	}
+}
+
+// onError calls the OnError hooks for a failed attempt
+func (c Connection) onError(ctx context.Context, x *Exchange, err error) {
+	if x == nil {
+		return
+	}
+	x.BytesSent = atomic.LoadInt64(x.sent)
+	interceptors := c.options().interceptors
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		if hook := interceptors[i].OnError; hook != nil {
+			hook(ctx, x, err)
+		}
+	}
+}
+
+// countingBody counts the bytes read from a request or response body, calling onClose (if set) the first time it's
+// closed.  Request bodies are read by the http transport's own goroutine, so the count is updated atomically.
+type countingBody struct {
+	io.ReadCloser
+	n       *int64
+	onClose func()
+	once    sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	atomic.AddInt64(b.n, int64(n))
+	return
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		if b.onClose != nil {
+			b.onClose()
+		}
+	})
+	return err
+}
@@ -0,0 +1,126 @@
+package dbhub_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exchangeLog records the calls made to an interceptor's hooks
+type exchangeLog struct {
+	name  string
+	calls *[]string
+	seen  []dbhub.Exchange
+	errs  []error
+}
+
+// interceptor returns an interceptor adding its calls to the log
+func (l *exchangeLog) interceptor() dbhub.Interceptor {
+	return dbhub.Interceptor{
+		BeforeRequest: func(ctx context.Context, x *dbhub.Exchange) error {
+			*l.calls = append(*l.calls, l.name+" before "+x.Endpoint)
+			x.Header.Set("X-Request-Id", "request-"+l.name)
+			return nil
+		},
+		AfterResponse: func(ctx context.Context, x *dbhub.Exchange) {
+			*l.calls = append(*l.calls, l.name+" after "+x.Endpoint)
+			l.seen = append(l.seen, *x)
+		},
+		OnError: func(ctx context.Context, x *dbhub.Exchange, err error) {
+			*l.calls = append(*l.calls, l.name+" error "+x.Endpoint)
+			l.seen = append(l.seen, *x)
+			l.errs = append(l.errs, err)
+		},
+	}
+}
+
+// headerRecorder records the X-Request-Id header of each request
+type headerRecorder []string
+
+func (h *headerRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	*h = append(*h, req.Header.Get("X-Request-Id"))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// TestInterceptor verifies the interceptor hooks are called around each request, with its details
+func TestInterceptor(t *testing.T) {
+	srv, _, dbBytes, _, _ := newVerifyServer(t, nil)
+	var calls []string
+	first, second := &exchangeLog{name: "first", calls: &calls}, &exchangeLog{name: "second", calls: &calls}
+	var headers headerRecorder
+	conn, err := srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithTransport(&headers),
+		dbhub.WithInterceptor(first.interceptor()), dbhub.WithInterceptor(second.interceptor()),
+		dbhub.WithRetryPolicy(dbhub.RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond}))
+	require.NoError(t, err)
+
+	// The hooks are called like layers of an onion, and the API key isn't passed on
+	start := time.Now()
+	tables, err := conn.Tables(dbhubtest.DefaultUser, "example.db", dbhub.Identifier{Tag: "first"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first before /v1/tables", "second before /v1/tables", "second after /v1/tables",
+		"first after /v1/tables"}, calls)
+	assert.Equal(t, []string{"request-second"}, []string(headers))
+	require.Len(t, first.seen, 1)
+	x := first.seen[0]
+	assert.Equal(t, "/v1/tables", x.Endpoint)
+	assert.Equal(t, dbhub.RedactedAPIKey, x.Form.Get("apikey"))
+	assert.Equal(t, "example.db", x.Form.Get("dbname"))
+	assert.Equal(t, "first", x.Form.Get("tag"))
+	assert.Equal(t, 1, x.Attempt)
+	assert.Equal(t, http.StatusOK, x.StatusCode)
+	assert.True(t, x.Latency > 0 && x.Latency <= time.Since(start))
+	assert.Equal(t, int64(len(x.Form.Encode())-len(dbhub.RedactedAPIKey)+len(dbhubtest.DefaultAPIKey)), x.BytesSent)
+	assert.GreaterOrEqual(t, x.BytesReceived, int64(len(`[""]`)+len(strings.Join(tables, `","`))))
+
+	// Failed attempts go to OnError, including those which are retried
+	calls, first.seen = nil, nil
+	srv.Script("/v1/tables", dbhubtest.Fault{Status: http.StatusServiceUnavailable})
+	_, err = conn.Tables(dbhubtest.DefaultUser, "example.db", dbhub.Identifier{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first before /v1/tables", "second before /v1/tables", "second error /v1/tables",
+		"first error /v1/tables", "first before /v1/tables", "second before /v1/tables", "second after /v1/tables",
+		"first after /v1/tables"}, calls)
+	require.Len(t, first.seen, 2)
+	assert.Equal(t, http.StatusServiceUnavailable, first.seen[0].StatusCode)
+	assert.Equal(t, 2, first.seen[1].Attempt)
+	var apiErr *dbhub.APIError
+	assert.ErrorAs(t, first.errs[0], &apiErr)
+	_, err = conn.Query(dbhubtest.DefaultUser, "example.db", dbhub.Identifier{}, false, "SELECT * FROM missing")
+	assert.Error(t, err)
+	assert.ErrorIs(t, first.errs[1], err)
+
+	// Uploads count the bytes sent, but leave the database out of the form values
+	first.seen = nil
+	require.NoError(t, conn.Upload("copy.db", dbhub.UploadInformation{}, &dbBytes))
+	x = first.seen[0]
+	assert.Equal(t, "/v1/upload", x.Endpoint)
+	assert.Equal(t, "copy.db", x.Form.Get("dbname"))
+	assert.Len(t, x.Form, 2)
+	assert.Greater(t, x.BytesSent, int64(len(dbBytes)))
+	assert.Equal(t, http.StatusCreated, x.StatusCode)
+
+	// A BeforeRequest error stops the request
+	stop := errors.New("stopped")
+	calls = nil
+	conn, err = srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithInterceptor(first.interceptor()),
+		dbhub.WithInterceptor(dbhub.Interceptor{BeforeRequest: func(ctx context.Context, x *dbhub.Exchange) error {
+			return stop
+		}}))
+	require.NoError(t, err)
+	calls0 := srv.Calls("/v1/views")
+	_, err = conn.Views(dbhubtest.DefaultUser, "example.db", dbhub.Identifier{})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, calls0, srv.Calls("/v1/views"))
+	assert.Equal(t, []string{"first before /v1/views"}, calls)
+
+	_, err = dbhub.New("key", dbhub.WithInterceptor(dbhub.Interceptor{}))
+	assert.EqualError(t, err, "the interceptor has no hooks")
+}
@@ -0,0 +1,197 @@
+package dbhub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// defaultThrottlePause is how long requests are paused for when the server throttles us without saying for how long
+const defaultThrottlePause = time.Second
+
+// maxThrottlePause is the longest requests are paused for when the server throttles us.  A shorter limit is used when
+// the retry policy's MaxBackoff is below this.
+const maxThrottlePause = 30 * time.Second
+
+// limiter enforces the client side request rate and concurrency limits of a connection.  It's shared by all copies of
+// the Connection it was created for, and is safe for concurrent use.
+type limiter struct {
+	mu          sync.Mutex
+	rate        float64   // The configured number of requests per second, or zero for no limit
+	current     float64   // The rate currently in use.  This is lowered after the server throttles us
+	burst       float64   // The number of requests which can be sent at once after being idle
+	tokens      float64   // The number of requests which can be sent right now
+	last        time.Time // When the tokens were last topped up
+	pausedUntil time.Time // When the server throttles us, no requests are sent until this time
+
+	// slots limits the number of requests in flight at once.  It's nil when there's no limit.
+	slots chan struct{}
+}
+
+// WithRateLimit limits the connection to sending at most perSecond requests each second, with up to burst requests
+// allowed at once after being idle.  The limit is shared by all goroutines using the connection.  When the server
+// throttles requests anyway, the rate is lowered and slowly recovers again as requests succeed.  Requests are also
+// paused for as long as the server asks, up to 30 seconds or the retry policy's MaxBackoff if that's shorter.  Requests
+// whose context deadline comes before the pause ends fail straight away with ErrRateLimited.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *Connection) error {
+		if perSecond <= 0 {
+			return fmt.Errorf("rate limit must be above zero")
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		l := c.getLimiter()
+		l.rate = perSecond
+		l.current = perSecond
+		l.burst = float64(burst)
+		l.tokens = float64(burst)
+		return nil
+	}
+}
+
+// WithMaxConcurrency limits the number of requests the connection has in flight at once.  The limit is shared by all
+// goroutines using the connection.  A request counts as in flight until its response has been read, so this also
+// limits the number of downloads running at once.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Connection) error {
+		if n < 1 {
+			return fmt.Errorf("maximum concurrency must be at least one")
+		}
+		c.getLimiter().slots = make(chan struct{}, n)
+		return nil
+	}
+}
+
+// getLimiter returns the limiter for the connection, creating it first if needed
+func (c *Connection) getLimiter() *limiter {
+	if c.limiter == nil {
+		c.limiter = &limiter{last: time.Now()}
+	}
+	return c.limiter
+}
+
+// acquire waits until a request is allowed to be sent.  The returned function must be called once the request has
+// completed, including reading its response body, to free up its concurrency slot.
+func (l *limiter) acquire(ctx context.Context) (release func(), err error) {
+	release = func() {}
+	if l == nil {
+		return
+	}
+
+	// Wait for a free concurrency slot
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+
+	// Wait until the rate limit allows another request.  If the server has paused requests for longer than the
+	// context allows, there's no point waiting.
+	for {
+		wait, paused := l.reserve(time.Now())
+		if wait == 0 {
+			return
+		}
+		if deadline, ok := ctx.Deadline(); ok && paused && time.Now().Add(wait).After(deadline) {
+			err = fmt.Errorf("requests are paused for another %s after being throttled by the server: %w", wait,
+				ErrRateLimited)
+		} else {
+			err = sleepContext(ctx, wait)
+		}
+		if err != nil {
+			release()
+			release = func() {}
+			return
+		}
+	}
+}
+
+// releasingBody is a response body which frees the concurrency slot of its request the first time it's closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// reserve takes a request token if one is available, otherwise returning how long to wait before trying again.
+// paused is true if the wait is because the server throttled us.
+func (l *limiter) reserve(now time.Time) (wait time.Duration, paused bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now), true
+	}
+	if l.rate <= 0 {
+		return 0, false
+	}
+
+	// Top up the available tokens for the time which has passed
+	l.tokens += now.Sub(l.last).Seconds() * l.current
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, false
+	}
+	return time.Duration((1 - l.tokens) / l.current * float64(time.Second)), false
+}
+
+// throttled is called when the server tells us we're sending too many requests.  All requests are paused for the time
+// the server asked for, up to maxThrottlePause or maxPause (if it's set) whichever is shorter, and the request rate is
+// halved.
+func (l *limiter) throttled(retryAfter, maxPause time.Duration) {
+	if l == nil {
+		return
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultThrottlePause
+	}
+	if maxPause <= 0 || maxPause > maxThrottlePause {
+		maxPause = maxThrottlePause
+	}
+	if retryAfter > maxPause {
+		retryAfter = maxPause
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	if l.rate > 0 {
+		l.current /= 2
+		if min := l.rate / 64; l.current < min {
+			l.current = min
+		}
+		l.tokens = 0
+	}
+}
+
+// succeeded is called after each request the server didn't throttle, to let a lowered request rate recover
+func (l *limiter) succeeded() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current < l.rate {
+		l.current += l.rate / 20
+		if l.current > l.rate {
+			l.current = l.rate
+		}
+	}
+}
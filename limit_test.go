@@ -0,0 +1,165 @@
+package dbhub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMaxConcurrency verifies the number of requests in flight at once is capped, across goroutines
+func TestMaxConcurrency(t *testing.T) {
+	// Create a test server which keeps track of the most requests it has been handling at once
+	var inFlight, most int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	conn, err := New("somekey", WithMaxConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	// Send a bunch of requests at once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := conn.Tables("default", "some.sqlite", Identifier{})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&most))
+}
+
+// TestMaxConcurrencyBody verifies a request keeps its concurrency slot until its response body is closed
+func TestMaxConcurrencyBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	conn, err := New("somekey", WithMaxConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	// Hold a download open, and check other requests wait for it
+	db, err := conn.Download("default", "some.sqlite", Identifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := conn.Tables("default", "some.sqlite", Identifier{})
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("the second request didn't wait for the download to finish")
+	case <-time.After(50 * time.Millisecond):
+	}
+	db.Close()
+	select {
+	case err = <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second request wasn't sent after the download finished")
+	}
+}
+
+// TestRateLimit verifies requests are spaced out to match the rate limit
+func TestRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	conn, err := New("somekey", WithRateLimit(50, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	// At 50 requests per second, six requests need at least 100ms
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		_, err = conn.Tables("default", "some.sqlite", Identifier{})
+		assert.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 95*time.Millisecond)
+}
+
+// TestRateLimitThrottled verifies the request rate is lowered when the server throttles us, and then recovers
+func TestRateLimitThrottled(t *testing.T) {
+	l := &limiter{rate: 100, current: 100, burst: 1, tokens: 1, last: time.Now()}
+
+	// Requests are paused for as long as the server asks
+	l.throttled(50*time.Millisecond, 0)
+	assert.Equal(t, float64(50), l.current)
+	wait, paused := l.reserve(time.Now())
+	assert.True(t, paused)
+	assert.Greater(t, wait, 40*time.Millisecond)
+	assert.LessOrEqual(t, wait, 50*time.Millisecond)
+
+	// The rate recovers as requests succeed, but never goes above the configured limit
+	for i := 0; i < 20; i++ {
+		l.succeeded()
+	}
+	assert.Equal(t, float64(100), l.current)
+}
+
+// TestRateLimitLongRetryAfter verifies a long Retry-After from the server doesn't stall the connection
+func TestRateLimitLongRetryAfter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 200 * time.Millisecond}
+	conn, err := New("somekey", WithRateLimit(100, 1), WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	// The server asks for a longer wait than the retry policy allows, so the request gives up
+	_, err = conn.Tables("default", "some.sqlite", Identifier{})
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Requests which can't wait for the pause to end fail straight away
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = conn.TablesContext(ctx, "default", "some.sqlite", Identifier{})
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Other requests only wait until the end of the capped pause, not for an hour
+	start := time.Now()
+	_, err = conn.Tables("default", "some.sqlite", Identifier{})
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,249 @@
+package dbhub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockFileName is the usual name of a lock file
+const LockFileName = "dbhub.lock"
+
+// LockFile pins databases to exact commits, in the same way go.sum does for Go modules.  Each entry records the
+// version of the database which was asked for, the commit that resolved to, and the size and SHA256 of the database
+// file in that commit.  Downloading with DownloadLocked() then always fetches that commit, and fails if its contents
+// don't match, even if the branch or tag has since moved.
+//
+// Lock files are stored as JSON, with one entry per database sorted by owner and name, so they give readable diffs
+// when kept in version control.
+type LockFile struct {
+	Databases []LockEntry `json:"databases"`
+}
+
+// LockEntry is the locked version of a single database
+type LockEntry struct {
+	Owner    string     `json:"owner"`
+	Name     string     `json:"name"`
+	Ident    Identifier `json:"-"`      // The version of the database which was asked for
+	CommitID string     `json:"commit"` // The commit Ident resolved to when the database was locked
+	Sha256   string     `json:"sha256"` // The SHA256 of the database file in the commit
+	Size     int64      `json:"size"`   // The size of the database file in the commit
+}
+
+// lockEntryJSON is how a LockEntry is stored.  The requested version is kept in the "@" form used by ParseRef(), eg
+// "main" or "tag:v1", with an empty string meaning the default branch.
+type lockEntryJSON struct {
+	Owner    string `json:"owner"`
+	Name     string `json:"name"`
+	Ref      string `json:"ref"`
+	CommitID string `json:"commit"`
+	Sha256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+}
+
+// MarshalJSON stores the entry with its requested version in a readable form
+func (e LockEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(lockEntryJSON{Owner: e.Owner, Name: e.Name, Ref: formatVersion(e.Ident), CommitID: e.CommitID,
+		Sha256: e.Sha256, Size: e.Size})
+}
+
+// UnmarshalJSON reads an entry written by MarshalJSON()
+func (e *LockEntry) UnmarshalJSON(data []byte) (err error) {
+	var j lockEntryJSON
+	if err = json.Unmarshal(data, &j); err != nil {
+		return
+	}
+	*e = LockEntry{Owner: j.Owner, Name: j.Name, CommitID: j.CommitID, Sha256: j.Sha256, Size: j.Size}
+	if j.Ref != "" {
+		if e.Ident, err = parseVersion(j.Ref); err != nil {
+			return fmt.Errorf("lock file entry for '%s/%s' ref '%s' %w", j.Owner, j.Name, j.Ref, err)
+		}
+	}
+	if e.Owner == "" || e.Name == "" || e.CommitID == "" || e.Sha256 == "" {
+		return fmt.Errorf("lock file entry for '%s/%s' is missing details", j.Owner, j.Name)
+	}
+	return
+}
+
+// Ref returns the reference to the database version which was asked for
+func (e LockEntry) Ref() Ref {
+	return Ref{Owner: e.Owner, Name: e.Name, Ident: e.Ident}
+}
+
+// VerifyFile checks a local copy of the database matches the locked size and SHA256.  If it doesn't, the error is a
+// *VerificationError.
+func (e LockEntry) VerifyFile(path string) (err error) {
+	var f *os.File
+	f, err = os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	h := sha256.New()
+	var n int64
+	n, err = io.Copy(h, io.LimitReader(f, e.Size+1))
+	if err != nil {
+		return
+	}
+	return verify(e.CommitID, e.treeEntry(), n, hex.EncodeToString(h.Sum(nil)))
+}
+
+// treeEntry returns the locked details of the database file, in the form used by commits
+func (e LockEntry) treeEntry() DBTreeEntry {
+	return DBTreeEntry{EntryType: DATABASE, Name: e.Name, Sha256: e.Sha256, Size: e.Size}
+}
+
+// ReadLockFile reads a lock file.  If the file doesn't exist, the error matches os.ErrNotExist.
+func ReadLockFile(path string) (lock *LockFile, err error) {
+	var data []byte
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	lock = &LockFile{}
+	if err = json.Unmarshal(data, lock); err != nil {
+		lock = nil
+		err = fmt.Errorf("couldn't read lock file '%s': %w", path, err)
+	}
+	return
+}
+
+// WriteFile saves the lock file.  The new file is renamed into place, so an existing lock file is never left half
+// written.
+func (l *LockFile) WriteFile(path string) (err error) {
+	l.sort()
+	var data []byte
+	data, err = json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return
+	}
+	var f *os.File
+	f, err = os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return
+}
+
+// Find returns the lock file entry for a database
+func (l *LockFile) Find(dbOwner, dbName string) (entry LockEntry, ok bool) {
+	for _, e := range l.Databases {
+		if e.Owner == dbOwner && e.Name == dbName {
+			return e, true
+		}
+	}
+	return
+}
+
+// Remove takes a database out of the lock file, returning false if it wasn't there
+func (l *LockFile) Remove(dbOwner, dbName string) bool {
+	for i, e := range l.Databases {
+		if e.Owner == dbOwner && e.Name == dbName {
+			l.Databases = append(l.Databases[:i], l.Databases[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// set adds an entry to the lock file, replacing any existing entry for the same database
+func (l *LockFile) set(entry LockEntry) {
+	for i, e := range l.Databases {
+		if e.Owner == entry.Owner && e.Name == entry.Name {
+			l.Databases[i] = entry
+			return
+		}
+	}
+	l.Databases = append(l.Databases, entry)
+	l.sort()
+}
+
+// sort puts the lock file entries in order of owner and name
+func (l *LockFile) sort() {
+	sort.Slice(l.Databases, func(i, j int) bool {
+		a, b := l.Databases[i], l.Databases[j]
+		if a.Owner != b.Owner {
+			return a.Owner < b.Owner
+		}
+		return a.Name < b.Name
+	})
+}
+
+// Lock adds a database to the lock file, pinning it to the commit the identifier currently points to.  If the database
+// is already in the lock file, its entry is replaced.  Only standard databases can be locked, as Live databases don't
+// have commits.
+func (c Connection) Lock(ctx context.Context, lock *LockFile, dbOwner, dbName string, ident Identifier) (entry LockEntry, err error) {
+	var commitID string
+	var tree DBTreeEntry
+	commitID, tree, err = c.resolveEntry(ctx, dbOwner, dbName, ident)
+	if err != nil {
+		return
+	}
+	entry = LockEntry{Owner: dbOwner, Name: dbName, Ident: ident, CommitID: commitID, Sha256: tree.Sha256,
+		Size: tree.Size}
+	lock.set(entry)
+	return
+}
+
+// UpdateLock resolves the requested version of each database in the lock file again, moving them to the commits their
+// branches, tags, and releases now point to.  The entries which changed are returned.
+func (c Connection) UpdateLock(ctx context.Context, lock *LockFile) (changed []LockEntry, err error) {
+	for _, e := range append([]LockEntry(nil), lock.Databases...) {
+		var updated LockEntry
+		updated, err = c.Lock(ctx, lock, e.Owner, e.Name, e.Ident)
+		if err != nil {
+			err = fmt.Errorf("couldn't update the lock for '%s': %w", e.Ref(), err)
+			return
+		}
+		if updated != e {
+			changed = append(changed, updated)
+		}
+	}
+	return
+}
+
+// VerifyLock checks every locked commit still exists on the server, with a database file matching the locked size and
+// SHA256.  The first problem found is returned, and mismatched database files give a *VerificationError.
+func (c Connection) VerifyLock(ctx context.Context, lock *LockFile) (err error) {
+	for _, e := range lock.Databases {
+		var tree DBTreeEntry
+		_, tree, err = c.resolveEntry(ctx, e.Owner, e.Name, Identifier{CommitID: e.CommitID})
+		if err == nil && (tree.Size != e.Size || !strings.EqualFold(tree.Sha256, e.Sha256)) {
+			err = &VerificationError{CommitID: e.CommitID, ExpectedSize: e.Size, ActualSize: tree.Size,
+				ExpectedSHA: e.Sha256, ActualSHA: tree.Sha256}
+		}
+		if err != nil {
+			err = fmt.Errorf("locked database '%s' doesn't match the server: %w", e.Ref(), err)
+			return
+		}
+	}
+	return
+}
+
+// DownloadLocked downloads the exact commit of a database recorded in a lock file entry into a file, in the same way
+// as DownloadToFile().  The database is checked against the size and SHA256 in the lock file rather than the ones
+// reported by the server, so if the server sends anything else the error is a *VerificationError.
+func (c Connection) DownloadLocked(ctx context.Context, entry LockEntry, path string) error {
+	if entry.CommitID == "" || entry.Sha256 == "" {
+		return errors.New("the lock file entry doesn't have a commit and SHA256")
+	}
+	return c.downloadToFile(ctx, entry.Owner, entry.Name, entry.CommitID, entry.treeEntry(), path)
+}
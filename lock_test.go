@@ -0,0 +1,108 @@
+package dbhub_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLockFile verifies databases can be locked to a commit, saved, updated, and verified
+func TestLockFile(t *testing.T) {
+	srv, conn, dbBytes, commit1, commit2 := newVerifyServer(t, nil)
+	ctx := context.Background()
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, dbhub.LockFileName)
+
+	// Create a lock file holding a database locked to a branch, and another locked to a tag
+	_, err := srv.AddDatabase(dbhubtest.DefaultUser, "another.db", dbBytes, dbhub.UploadInformation{})
+	require.NoError(t, err)
+	lock := &dbhub.LockFile{}
+	entry, err := conn.Lock(ctx, lock, dbhubtest.DefaultUser, "example.db", dbhub.Identifier{Branch: "main"})
+	require.NoError(t, err)
+	assert.Equal(t, commit2, entry.CommitID)
+	assert.Equal(t, int64(len(dbBytes)+4096), entry.Size)
+	_, err = conn.Lock(ctx, lock, dbhubtest.DefaultUser, "another.db", dbhub.Identifier{})
+	require.NoError(t, err)
+	entry, err = conn.Lock(ctx, lock, dbhubtest.DefaultUser, "example.db", dbhub.Identifier{Tag: "first"})
+	require.NoError(t, err)
+	assert.Equal(t, commit1, entry.CommitID)
+	require.Len(t, lock.Databases, 2)
+	assert.Equal(t, "another.db", lock.Databases[0].Name)
+	require.NoError(t, lock.WriteFile(lockPath))
+
+	data, err := os.ReadFile(lockPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"ref": "tag:first"`)
+	read, err := dbhub.ReadLockFile(lockPath)
+	require.NoError(t, err)
+	assert.Equal(t, lock, read)
+	require.NoError(t, conn.VerifyLock(ctx, read))
+
+	// Download the locked commit, which stays the same even after the database changes
+	_, err = conn.Lock(ctx, lock, dbhubtest.DefaultUser, "example.db", dbhub.Identifier{})
+	require.NoError(t, err)
+	commit3, err := srv.AddDatabase(dbhubtest.DefaultUser, "example.db", append(append([]byte{}, dbBytes...), 1, 2, 3),
+		dbhub.UploadInformation{Ident: dbhub.Identifier{CommitID: commit2}})
+	require.NoError(t, err)
+	entry, ok := lock.Find(dbhubtest.DefaultUser, "example.db")
+	require.True(t, ok)
+	path := filepath.Join(dir, "example.db")
+	require.NoError(t, conn.DownloadLocked(ctx, entry, path))
+	require.NoError(t, entry.VerifyFile(path))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), entry.Size)
+
+	// Updating moves the branch to the new commit, but leaves the other database alone
+	changed, err := conn.UpdateLock(ctx, lock)
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, commit3, changed[0].CommitID)
+	entry, _ = lock.Find(dbhubtest.DefaultUser, "example.db")
+	assert.Equal(t, commit3, entry.CommitID)
+	assert.ErrorIs(t, entry.VerifyFile(path), dbhub.ErrVerificationFailed)
+
+	assert.True(t, lock.Remove(dbhubtest.DefaultUser, "another.db"))
+	assert.False(t, lock.Remove(dbhubtest.DefaultUser, "another.db"))
+	_, ok = lock.Find(dbhubtest.DefaultUser, "another.db")
+	assert.False(t, ok)
+}
+
+// TestLockFileMismatch verifies locked databases which don't match the server are rejected
+func TestLockFileMismatch(t *testing.T) {
+	_, conn, _, commit1, _ := newVerifyServer(t, nil)
+	ctx := context.Background()
+	lock := &dbhub.LockFile{}
+	entry, err := conn.Lock(ctx, lock, dbhubtest.DefaultUser, "example.db", dbhub.Identifier{CommitID: commit1})
+	require.NoError(t, err)
+
+	// Pretend the lock was made when the commit had a different database
+	lock.Databases[0].Sha256 = strings.Repeat("0", 64)
+	err = conn.VerifyLock(ctx, lock)
+	assert.ErrorIs(t, err, dbhub.ErrVerificationFailed)
+	path := filepath.Join(t.TempDir(), "example.db")
+	err = conn.DownloadLocked(ctx, lock.Databases[0], path)
+	assert.ErrorIs(t, err, dbhub.ErrVerificationFailed)
+	assert.NoFileExists(t, path)
+
+	// Locked commits which have gone from the server
+	entry.CommitID = strings.Repeat("1", 64)
+	err = conn.VerifyLock(ctx, &dbhub.LockFile{Databases: []dbhub.LockEntry{entry}})
+	assert.ErrorIs(t, err, dbhub.ErrNotFound)
+
+	// Lock files with bad entries
+	path = filepath.Join(t.TempDir(), dbhub.LockFileName)
+	require.NoError(t, os.WriteFile(path, []byte(`{"databases":[{"owner":"a","name":"b","ref":"label:x",`+
+		`"commit":"c","sha256":"d","size":1}]}`), 0644))
+	_, err = dbhub.ReadLockFile(path)
+	assert.Error(t, err)
+	_, err = dbhub.ReadLockFile(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
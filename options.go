@@ -0,0 +1,62 @@
+package dbhub
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// defaultClient and insecureClient are shared by all connections not using a caller provided client or transport
+	defaultClient  = newHTTPClient(true, nil)
+	insecureClient = newHTTPClient(false, nil)
+)
+
+// Option configures optional behaviour of a Connection when it's created with New()
+type Option func(*Connection) error
+
+// WithHTTPClient makes the connection send all of its requests through the given http.Client.  This can be used to
+// add proxies, timeouts, custom dialers, or instrumented round trippers.  As the client is provided by the caller, its
+// transport is used as is and ChangeVerifyServerCert() has no effect on it.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Connection) error {
+		if client == nil {
+			return fmt.Errorf("no http client provided")
+		}
+		c.httpClient = client
+		return nil
+	}
+}
+
+// WithTransport makes the connection send all of its requests through the given http.RoundTripper.  As with
+// WithHTTPClient(), ChangeVerifyServerCert() has no effect on a caller provided transport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Connection) error {
+		if rt == nil {
+			return fmt.Errorf("no http transport provided")
+		}
+		c.httpClient = &http.Client{Transport: rt}
+		return nil
+	}
+}
+
+// newHTTPClient creates an http client with its own pooled transport.  Reusing the client lets requests reuse open
+// server connections, instead of doing a new TLS handshake each time.  cfg holds any custom TLS settings.
+func newHTTPClient(verifyServerCert bool, cfg *tls.Config) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.MaxIdleConnsPerHost = 16
+	tr.IdleConnTimeout = 90 * time.Second
+	if cfg != nil {
+		tr.TLSClientConfig = cfg.Clone()
+	}
+
+	// Disable verification of the server https cert, if we've been told to
+	if !verifyServerCert {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.InsecureSkipVerify = true
+	}
+	return &http.Client{Transport: tr}
+}
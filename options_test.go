@@ -0,0 +1,77 @@
+package dbhub
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConnectionReuse verifies requests made with one Connection share a single server connection
+func TestConnectionReuse(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts func(srv *httptest.Server) []Option
+	}{
+		{"default client", func(*httptest.Server) []Option { return nil }},
+		{"caller's client", func(srv *httptest.Server) []Option { return []Option{WithHTTPClient(srv.Client())} }},
+		{"caller's transport", func(srv *httptest.Server) []Option { return []Option{WithTransport(srv.Client().Transport)} }},
+	} {
+		// Create a test server which counts the connections made to it
+		var conns int32
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[[{"Name":"id","Type":4,"Value":1}]]` + "\n"))
+		}))
+		srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&conns, 1)
+			}
+		}
+		srv.StartTLS()
+
+		conn, err := New("somekey", tt.opts(srv)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.ChangeServer(srv.URL)
+		conn.ChangeVerifyServerCert(false)
+		for i := 0; i < 5; i++ {
+			_, err = conn.Query("default", "some.sqlite", Identifier{}, false, "SELECT id FROM table1")
+			assert.NoError(t, err, tt.name)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&conns), tt.name)
+		srv.Close()
+	}
+}
+
+// TestNilHTTPClient verifies a missing client or transport is rejected
+func TestNilHTTPClient(t *testing.T) {
+	_, err := New("somekey", WithHTTPClient(nil))
+	assert.EqualError(t, err, "no http client provided")
+	_, err = New("somekey", WithTransport(nil))
+	assert.EqualError(t, err, "no http transport provided")
+}
+
+// TestConnectionComparable verifies Connection values can still be compared, and used as map keys, when options
+// holding functions are set
+func TestConnectionComparable(t *testing.T) {
+	conn, err := New("somekey",
+		WithProgress(func(Progress) {}),
+		WithInterceptor(Interceptor{BeforeRequest: func(context.Context, *Exchange) error { return nil }}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New("somekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := map[Connection]string{conn: "conn", other: "other"}
+	copied := conn
+	assert.Equal(t, "conn", conns[copied])
+	assert.True(t, copied == conn)
+	assert.False(t, other == conn)
+}
@@ -0,0 +1,105 @@
+package dbhub
+
+import (
+	"io"
+	"time"
+)
+
+// progressInterval is the minimum time between progress reports, so callbacks aren't swamped by small reads
+const progressInterval = 100 * time.Millisecond
+
+// Progress describes how far a database download or upload has got
+type Progress struct {
+	Endpoint string        // The API end point of the transfer, ie "/v1/download" or "/v1/upload"
+	DBName   string        // The name of the database being transferred
+	Done     int64         // The number of bytes transferred so far
+	Total    int64         // The total size of the transfer in bytes, or -1 if it isn't known
+	Rate     float64       // The average transfer rate so far, in bytes per second
+	ETA      time.Duration // The estimated time remaining, or -1 if it isn't known
+}
+
+// ProgressFunc is called with updates as databases are downloaded and uploaded.  Calls are made at most every 100ms,
+// along with a final call once the transfer is complete.  The function is called from the goroutine moving the data,
+// so it should return quickly.
+type ProgressFunc func(p Progress)
+
+// WithProgress makes the connection report the progress of database transfers to f.  This covers the reader returned
+// by Download() and DownloadContext(), and all of the Upload functions.  If an upload is retried, progress starts
+// again from zero.
+func WithProgress(f ProgressFunc) Option {
+	return func(c *Connection) error {
+		c.setOptions(func(o *connOptions) { o.progress = f })
+		return nil
+	}
+}
+
+// progressReader reports the progress of the data read through it
+type progressReader struct {
+	r        io.Reader
+	f        ProgressFunc
+	p        Progress
+	offset   int64 // The amount already transferred before this reader started, eg when resuming a download
+	start    time.Time
+	last     time.Time
+	finished bool
+}
+
+// newProgressReader wraps r so reads from it are reported to f.  offset is the number of bytes of the transfer which
+// were already done before reading from r.  If f is nil, r is returned as is.
+func newProgressReader(r io.Reader, f ProgressFunc, endpoint, dbName string, offset, total int64) io.Reader {
+	if f == nil {
+		return r
+	}
+	now := time.Now()
+	return &progressReader{r: r, f: f, offset: offset, start: now, last: now,
+		p: Progress{Endpoint: endpoint, DBName: dbName, Done: offset, Total: total, ETA: -1}}
+}
+
+func (pr *progressReader) Read(b []byte) (n int, err error) {
+	n, err = pr.r.Read(b)
+	pr.p.Done += int64(n)
+	now := time.Now()
+	if err == io.EOF || (pr.p.Total >= 0 && pr.p.Done >= pr.p.Total) {
+		// Only report the end once, even if the caller keeps reading
+		if pr.finished {
+			return
+		}
+		pr.finished = true
+	} else if n == 0 || now.Sub(pr.last) < progressInterval {
+		return
+	}
+	pr.last = now
+	pr.report(now)
+	return
+}
+
+// report calls the progress function with the current figures
+func (pr *progressReader) report(now time.Time) {
+	elapsed := now.Sub(pr.start).Seconds()
+	if elapsed > 0 {
+		pr.p.Rate = float64(pr.p.Done-pr.offset) / elapsed
+	}
+	switch {
+	case pr.p.Total >= 0 && pr.p.Done >= pr.p.Total:
+		pr.p.ETA = 0
+	case pr.p.Total >= 0 && pr.p.Rate > 0:
+		pr.p.ETA = time.Duration(float64(pr.p.Total-pr.p.Done) / pr.p.Rate * float64(time.Second))
+	default:
+		pr.p.ETA = -1
+	}
+	pr.f(pr.p)
+}
+
+// progressReadCloser is a progressReader which also closes the underlying reader
+type progressReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// newProgressReadCloser wraps rc so reads from it are reported to f.  If f is nil, rc is returned as is.
+func newProgressReadCloser(rc io.ReadCloser, f ProgressFunc, endpoint, dbName string, total int64) io.ReadCloser {
+	if f == nil {
+		return rc
+	}
+	return progressReadCloser{newProgressReader(rc, f, endpoint, dbName, 0, total), rc}
+}
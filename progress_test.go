@@ -0,0 +1,80 @@
+package dbhub_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// progressLog keeps the progress reports it's given
+type progressLog struct {
+	mu      sync.Mutex
+	reports []dbhub.Progress
+}
+
+func (l *progressLog) add(p dbhub.Progress) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reports = append(l.reports, p)
+}
+
+func (l *progressLog) last() dbhub.Progress {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reports[len(l.reports)-1]
+}
+
+// TestProgress verifies the progress of uploads and downloads is reported
+func TestProgress(t *testing.T) {
+	srv := dbhubtest.NewServer()
+	defer srv.Close()
+	log := &progressLog{}
+	conn, err := srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithProgress(log.add))
+	require.NoError(t, err)
+
+	dbBytes, err := os.ReadFile(filepath.Join("examples", "upload", "example.db"))
+	require.NoError(t, err)
+	size := int64(len(dbBytes))
+
+	_, err = conn.UploadReader(context.Background(), "example.db", dbhub.UploadInformation{}, bytes.NewReader(dbBytes),
+		size)
+	require.NoError(t, err)
+	p := log.last()
+	assert.Equal(t, "/v1/upload", p.Endpoint)
+	assert.Equal(t, "example.db", p.DBName)
+	assert.Equal(t, size, p.Done)
+	assert.Equal(t, size, p.Total)
+	assert.Zero(t, p.ETA)
+
+	// The final report for a download comes once all of the data has been read
+	log.reports = nil
+	body, err := conn.Download(dbhubtest.DefaultUser, "example.db", dbhub.Identifier{})
+	require.NoError(t, err)
+	_, err = io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	p = log.last()
+	assert.Equal(t, "/v1/download", p.Endpoint)
+	assert.Equal(t, size, p.Done)
+	assert.Equal(t, size, p.Total)
+	assert.Greater(t, p.Rate, 0.0)
+	assert.Len(t, log.reports, 1)
+
+	// Uploads of an unknown size still get a final report
+	log.reports = nil
+	_, err = conn.UploadLiveReader(context.Background(), "live.db", struct{ io.Reader }{bytes.NewReader(dbBytes)}, -1)
+	require.NoError(t, err)
+	p = log.last()
+	assert.Equal(t, size, p.Done)
+	assert.Equal(t, int64(-1), p.Total)
+	assert.Equal(t, int64(-1), int64(p.ETA))
+}
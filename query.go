@@ -0,0 +1,90 @@
+package dbhub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// newTypedResults converts the rows returned by the query end point into a TypedResults
+func newTypedResults(rows []DataRow) (out TypedResults, err error) {
+	// The server doesn't send a separate header, so the column names are taken from the first row
+	if len(rows) == 0 {
+		return
+	}
+	for _, v := range rows[0] {
+		out.Columns = append(out.Columns, ResultColumn{Name: v.Name, Type: Null})
+	}
+
+	// Convert each of the values to its native type
+	out.Rows = make([][]interface{}, 0, len(rows))
+	for i, row := range rows {
+		if len(row) != len(out.Columns) {
+			err = fmt.Errorf("row %d of the query results has %d values, but there are %d columns", i, len(row),
+				len(out.Columns))
+			return
+		}
+		vals := make([]interface{}, len(row))
+		for j, v := range row {
+			vals[j], err = typedValue(v)
+			if err != nil {
+				err = fmt.Errorf("column '%s' of row %d: %w", v.Name, i, err)
+				return
+			}
+			if vals[j] != nil && out.Columns[j].Type == Null {
+				out.Columns[j].Type = v.Type
+			}
+		}
+		out.Rows = append(out.Rows, vals)
+	}
+	return
+}
+
+// typedValue converts a value returned by the query end point to its native type
+func typedValue(v DataValue) (interface{}, error) {
+	if v.Type == Null || v.Value == nil {
+		return nil, nil
+	}
+	switch v.Type {
+	case Integer:
+		switch n := v.Value.(type) {
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+
+			// Very large or exponent formatted integers
+			f, err := n.Float64()
+			if err != nil {
+				return nil, err
+			}
+			return int64(f), nil
+		case string:
+			return strconv.ParseInt(n, 10, 64)
+		case float64:
+			return int64(n), nil
+		}
+	case Float:
+		switch n := v.Value.(type) {
+		case json.Number:
+			return n.Float64()
+		case string:
+			return strconv.ParseFloat(n, 64)
+		case float64:
+			return n, nil
+		}
+	case Text:
+		switch s := v.Value.(type) {
+		case string:
+			return s, nil
+		case json.Number:
+			return s.String(), nil
+		}
+	case Binary, Image:
+		// The server sends the raw bytes as a string, which has already lost any bytes that aren't valid UTF-8
+		if s, ok := v.Value.(string); ok {
+			return []byte(s), nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected data type '%T' for returned value of type %d", v.Value, v.Type)
+}
@@ -0,0 +1,103 @@
+package dbhub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestQueryTyped verifies query results keep their column names and native value types
+func TestQueryTyped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			[{"Name":"id","Type":4,"Value":1200000},{"Name":"score","Type":5,"Value":2.5},{"Name":"name","Type":3,"Value":"Foo"},{"Name":"data","Type":0,"Value":"\u0000\u0001\u00e9"}],
+			[{"Name":"id","Type":4,"Value":9007199254740993},{"Name":"score","Type":2,"Value":null},{"Name":"name","Type":3,"Value":""},{"Name":"data","Type":2,"Value":null}]
+		]`))
+	}))
+	defer srv.Close()
+	conn, err := New("somekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	result, err := conn.QueryTyped("default", "some.sqlite", Identifier{}, "SELECT id, score, name, data FROM table1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the column header
+	assert.Equal(t, []ResultColumn{{"id", Integer}, {"score", Float}, {"name", Text}, {"data", Binary}}, result.Columns)
+
+	// Verify the values, including large integers, NULLs, empty strings, and BLOBs
+	if assert.Len(t, result.Rows, 2) {
+		assert.Equal(t, []interface{}{int64(1200000), 2.5, "Foo", []byte{0, 1, 0xc3, 0xa9}}, result.Rows[0])
+		assert.Equal(t, []interface{}{int64(9007199254740993), nil, "", nil}, result.Rows[1])
+	}
+}
+
+// TestQueryTypedInvalidBlob verifies BLOB bytes which aren't valid UTF-8 come back as U+FFFD, as that's all the server
+// can send in JSON
+func TestQueryTypedInvalidBlob(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// This is how encoding/json writes a string holding the bytes 00 FF 80
+		w.Write([]byte(`[[{"Name":"data","Type":0,"Value":"\u0000\ufffd\ufffd"}]]`))
+	}))
+	defer srv.Close()
+	conn, err := New("somekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	result, err := conn.QueryTyped("default", "some.sqlite", Identifier{}, "SELECT data FROM table1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, result.Rows, 1) {
+		assert.Equal(t, []interface{}{[]byte{0, 0xef, 0xbf, 0xbd, 0xef, 0xbf, 0xbd}}, result.Rows[0])
+	}
+}
+
+// TestQueryTypedEmpty verifies a query returning no rows gives an empty result, without any columns
+func TestQueryTypedEmpty(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	conn, err := New("somekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	result, err := conn.QueryTyped("default", "some.sqlite", Identifier{}, "SELECT id FROM table1 WHERE 0")
+	assert.NoError(t, err)
+	assert.Empty(t, result.Columns)
+	assert.Empty(t, result.Rows)
+}
+
+// TestQueryCancelled verifies cancelling the context of a query which is slow to respond returns straight away
+func TestQueryCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	conn, err := New("somekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = conn.QueryContext(ctx, "default", "some.sqlite", Identifier{}, false, "SELECT id FROM table1")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,179 @@
+package dbhub
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Ref names a database on DBHub.io, along with the version of it to use
+type Ref struct {
+	Owner string
+	Name  string
+	Ident Identifier
+}
+
+// ParseRef parses a database reference.  These can be written in the short form used on the command line:
+//
+//	owner/database.sqlite                     the head of the default branch
+//	owner/database.sqlite@main                the head of a branch
+//	owner/database.sqlite#5a6fd3ce...         a commit
+//	owner/database.sqlite@tag:v1.0            a tag
+//	owner/database.sqlite@release:2023-06     a release
+//
+// or as the web page URL of a database, as returned by Webpage(), eg "https://dbhub.io/owner/database.sqlite".  A
+// branch, commit, tag, or release can be given in the URL using a query parameter of that name, the same as the web
+// interface does.
+//
+// In the short form the database name ends at the first "@" or "#", so owner and database names containing those
+// characters (or "%") need them percent-encoded, eg "owner/a%40b.sqlite".  String() does this automatically.
+func ParseRef(s string) (ref Ref, err error) {
+	if strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://") {
+		return parseWebURL(s)
+	}
+
+	// Split off the branch, commit, tag, or release
+	path, version := s, ""
+	sep := byte(0)
+	if i := strings.IndexAny(s, "@#"); i >= 0 {
+		path, sep, version = s[:i], s[i], s[i+1:]
+		if version == "" {
+			err = fmt.Errorf("database reference '%s' has nothing after the '%c'", s, sep)
+			return
+		}
+	}
+	switch sep {
+	case '#':
+		ref.Ident.CommitID = version
+	case '@':
+		if ref.Ident, err = parseVersion(version); err != nil {
+			err = fmt.Errorf("database reference '%s' %w", s, err)
+			return
+		}
+	}
+
+	// The rest is the owner and database name
+	owner, name, ok := strings.Cut(path, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		err = fmt.Errorf("database reference '%s' should start with owner/database", s)
+		return
+	}
+	if ref.Owner, err = url.PathUnescape(owner); err != nil {
+		err = fmt.Errorf("database reference '%s' has an invalid owner name: %w", s, err)
+		return
+	}
+	if ref.Name, err = url.PathUnescape(name); err != nil {
+		err = fmt.Errorf("database reference '%s' has an invalid database name: %w", s, err)
+		return
+	}
+	return
+}
+
+// parseWebURL parses the web page URL of a database
+func parseWebURL(s string) (ref Ref, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		err = fmt.Errorf("invalid database URL: %w", err)
+		return
+	}
+	// The path is split before being unescaped, so names holding an escaped "/" are kept whole
+	owner, name, ok := strings.Cut(strings.Trim(u.EscapedPath(), "/"), "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		err = fmt.Errorf("database URL '%s' should have a path of /owner/database", s)
+		return
+	}
+	if ref.Owner, err = url.PathUnescape(owner); err != nil {
+		err = fmt.Errorf("database URL '%s' has an invalid owner name: %w", s, err)
+		return
+	}
+	if ref.Name, err = url.PathUnescape(name); err != nil {
+		err = fmt.Errorf("database URL '%s' has an invalid database name: %w", s, err)
+		return
+	}
+	q := u.Query()
+	ref.Ident = Identifier{
+		Branch:   q.Get("branch"),
+		CommitID: q.Get("commit"),
+		Release:  q.Get("release"),
+		Tag:      q.Get("tag"),
+	}
+	if err = ref.Ident.validate(); err != nil {
+		ref = Ref{}
+	}
+	return
+}
+
+// parseVersion parses the part of a database reference after the "@", which names a branch, commit, release, or tag
+func parseVersion(s string) (ident Identifier, err error) {
+	kind, name, ok := strings.Cut(s, ":")
+	if !ok {
+		kind, name = "branch", s
+	}
+	if name == "" {
+		err = fmt.Errorf("has an empty %s name", kind)
+		return
+	}
+	switch kind {
+	case "branch":
+		ident.Branch = name
+	case "commit":
+		ident.CommitID = name
+	case "release":
+		ident.Release = name
+	case "tag":
+		ident.Tag = name
+	default:
+		err = fmt.Errorf("has an unknown version type '%s', it should be one of branch, commit, release, or tag", kind)
+	}
+	return
+}
+
+// formatVersion returns the version an identifier names in the form understood by parseVersion(), or an empty string
+// for the empty identifier
+func formatVersion(ident Identifier) string {
+	switch {
+	case ident.CommitID != "":
+		return "commit:" + ident.CommitID
+	case ident.Tag != "":
+		return "tag:" + ident.Tag
+	case ident.Release != "":
+		return "release:" + ident.Release
+	case strings.Contains(ident.Branch, ":"):
+		// Make sure branch names which look like a version type aren't mistaken for one
+		return "branch:" + ident.Branch
+	}
+	return ident.Branch
+}
+
+// String returns the short form of the reference, as understood by ParseRef()
+func (r Ref) String() string {
+	s := escapeRefName(r.Owner) + "/" + escapeRefName(r.Name)
+	switch {
+	case r.Ident.CommitID != "":
+		s += "#" + r.Ident.CommitID
+	case r.Ident != Identifier{}:
+		s += "@" + formatVersion(r.Ident)
+	}
+	return s
+}
+
+// WebURL returns the web page URL of the referenced database on a server, eg "https://dbhub.io"
+func (r Ref) WebURL(server string) string {
+	u := strings.TrimSuffix(server, "/") + "/" + url.PathEscape(r.Owner) + "/" + url.PathEscape(r.Name)
+	switch {
+	case r.Ident.CommitID != "":
+		u += "?commit=" + url.QueryEscape(r.Ident.CommitID)
+	case r.Ident.Tag != "":
+		u += "?tag=" + url.QueryEscape(r.Ident.Tag)
+	case r.Ident.Release != "":
+		u += "?release=" + url.QueryEscape(r.Ident.Release)
+	case r.Ident.Branch != "":
+		u += "?branch=" + url.QueryEscape(r.Ident.Branch)
+	}
+	return u
+}
+
+// escapeRefName percent-encodes the characters which would stop an owner or database name being parsed back correctly
+func escapeRefName(s string) string {
+	return strings.NewReplacer("%", "%25", "@", "%40", "#", "%23", "/", "%2F").Replace(s)
+}
@@ -0,0 +1,99 @@
+package dbhub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// refCorpus holds database references in their short form, with what they parse to
+var refCorpus = []struct {
+	s   string
+	ref Ref
+}{
+	{"justinclift/Join Testing.sqlite", Ref{Owner: "justinclift", Name: "Join Testing.sqlite"}},
+	{"justinclift/DB4S daily users.sqlite@master",
+		Ref{Owner: "justinclift", Name: "DB4S daily users.sqlite", Ident: Identifier{Branch: "master"}}},
+	{"justinclift/Join Testing.sqlite#ea12a0b5a0386d6d1bc4b63ad43c8baef4bcb77347bb6efcd2c9d63be8ccc5cc",
+		Ref{Owner: "justinclift", Name: "Join Testing.sqlite",
+			Ident: Identifier{CommitID: "ea12a0b5a0386d6d1bc4b63ad43c8baef4bcb77347bb6efcd2c9d63be8ccc5cc"}}},
+	{"owner/db.sqlite@tag:v1.0", Ref{Owner: "owner", Name: "db.sqlite", Ident: Identifier{Tag: "v1.0"}}},
+	{"owner/db.sqlite@release:2023-06 final",
+		Ref{Owner: "owner", Name: "db.sqlite", Ident: Identifier{Release: "2023-06 final"}}},
+	{"owner/db.sqlite@feature/new-thing", Ref{Owner: "owner", Name: "db.sqlite", Ident: Identifier{Branch: "feature/new-thing"}}},
+	{"owner/db.sqlite@fix#12", Ref{Owner: "owner", Name: "db.sqlite", Ident: Identifier{Branch: "fix#12"}}},
+	{"owner/db.sqlite@branch:tag:odd", Ref{Owner: "owner", Name: "db.sqlite", Ident: Identifier{Branch: "tag:odd"}}},
+	{"owner/a%40b%23c%25d.sqlite@main", Ref{Owner: "owner", Name: "a@b#c%d.sqlite", Ident: Identifier{Branch: "main"}}},
+	{"owner/2023%2F06 report.sqlite", Ref{Owner: "owner", Name: "2023/06 report.sqlite"}},
+	{"first.last/Ünïcode ✓.db@tag:ß", Ref{Owner: "first.last", Name: "Ünïcode ✓.db", Ident: Identifier{Tag: "ß"}}},
+}
+
+// TestParseRef verifies short form references are parsed, and turned back into the same string
+func TestParseRef(t *testing.T) {
+	for _, tt := range refCorpus {
+		ref, err := ParseRef(tt.s)
+		require.NoError(t, err, tt.s)
+		assert.Equal(t, tt.ref, ref, tt.s)
+		assert.Equal(t, tt.s, ref.String())
+	}
+
+	// Other ways of writing the same thing
+	alternatives := map[string]Ref{
+		"owner/db.sqlite@branch:main": {Owner: "owner", Name: "db.sqlite", Ident: Identifier{Branch: "main"}},
+		"owner/db.sqlite@commit:0123": {Owner: "owner", Name: "db.sqlite", Ident: Identifier{CommitID: "0123"}},
+		"owner/db%2Esqlite":           {Owner: "owner", Name: "db.sqlite"},
+	}
+	for s, want := range alternatives {
+		ref, err := ParseRef(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, ref, s)
+	}
+}
+
+// TestRefWebURL verifies references survive being turned into web page URLs and parsed back, including names with
+// characters which have to be escaped in URLs such as "/"
+func TestRefWebURL(t *testing.T) {
+	for _, tt := range refCorpus {
+		u := tt.ref.WebURL("https://dbhub.io/")
+		ref, err := ParseRef(u)
+		require.NoError(t, err, u)
+		assert.Equal(t, tt.ref, ref, u)
+	}
+	ref := Ref{Owner: "owner", Name: "2023/06 report.sqlite", Ident: Identifier{Tag: "v1"}}
+	assert.Equal(t, "https://dbhub.io/owner/2023%2F06%20report.sqlite?tag=v1", ref.WebURL("https://dbhub.io"))
+	ref = Ref{Owner: "justinclift", Name: "Join Testing.sqlite", Ident: Identifier{Branch: "master"}}
+	assert.Equal(t, "https://dbhub.io/justinclift/Join%20Testing.sqlite?branch=master", ref.WebURL("https://dbhub.io"))
+
+	// URLs as returned by Webpage()
+	ref, err := ParseRef("https://dbhub.io/justinclift/Join%20Testing.sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, Ref{Owner: "justinclift", Name: "Join Testing.sqlite"}, ref)
+	ref, err = ParseRef("http://localhost:9443/default/example.db/?tag=first")
+	require.NoError(t, err)
+	assert.Equal(t, Ref{Owner: "default", Name: "example.db", Ident: Identifier{Tag: "first"}}, ref)
+}
+
+// TestParseRefErrors verifies invalid references are rejected
+func TestParseRefErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"db.sqlite",
+		"/db.sqlite",
+		"owner/",
+		"owner/dir/db.sqlite",
+		"owner/db.sqlite@",
+		"owner/db.sqlite#",
+		"owner/db.sqlite@tag:",
+		"owner/db.sqlite@label:x",
+		"owner/db%zz.sqlite",
+		"@main",
+		"https://dbhub.io/owner",
+		"https://dbhub.io/branches/owner/db.sqlite",
+	} {
+		_, err := ParseRef(s)
+		assert.Error(t, err, s)
+	}
+	_, err := ParseRef("https://dbhub.io/owner/db.sqlite?branch=main&tag=v1")
+	assert.ErrorIs(t, err, ErrAmbiguousIdentifier)
+}
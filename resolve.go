@@ -0,0 +1,92 @@
+package dbhub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Resolve returns the ID of the commit an identifier points to.  An empty identifier means the head of the default
+// branch.  If more than one of the branch, commit, release, and tag are set the error matches ErrAmbiguousIdentifier,
+// and if the one which is set doesn't exist the error matches ErrNotFound.
+func (c Connection) Resolve(dbOwner, dbName string, ident Identifier) (commitID string, err error) {
+	return c.ResolveContext(context.Background(), dbOwner, dbName, ident)
+}
+
+// ResolveContext is like Resolve, but the request is bound to ctx so it can be cancelled or given a deadline
+func (c Connection) ResolveContext(ctx context.Context, dbOwner, dbName string, ident Identifier) (commitID string, err error) {
+	// Check the identifier first, so there's no need to ask the server about ones which can't be resolved anyway
+	if err = ident.validate(); err != nil {
+		return
+	}
+	var meta MetadataResponseContainer
+	meta, err = c.MetadataContext(ctx, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	return resolveIdent(meta, ident)
+}
+
+// validate checks at most one of the fields of an identifier is set
+func (ident Identifier) validate() error {
+	var set []string
+	if ident.Branch != "" {
+		set = append(set, fmt.Sprintf("branch '%s'", ident.Branch))
+	}
+	if ident.CommitID != "" {
+		set = append(set, fmt.Sprintf("commit '%s'", ident.CommitID))
+	}
+	if ident.Release != "" {
+		set = append(set, fmt.Sprintf("release '%s'", ident.Release))
+	}
+	if ident.Tag != "" {
+		set = append(set, fmt.Sprintf("tag '%s'", ident.Tag))
+	}
+	if len(set) > 1 {
+		return fmt.Errorf("the identifier can only name one of a branch, commit, release, or tag, but it has %s: %w",
+			strings.Join(set, " and "), ErrAmbiguousIdentifier)
+	}
+	return nil
+}
+
+// resolveIdent returns the commit an identifier points to, using the database metadata.  An empty identifier means
+// the head of the default branch.
+func resolveIdent(meta MetadataResponseContainer, ident Identifier) (commitID string, err error) {
+	if err = ident.validate(); err != nil {
+		return
+	}
+	switch {
+	case ident.CommitID != "":
+		if _, ok := meta.Commits[ident.CommitID]; !ok {
+			err = fmt.Errorf("commit '%s' doesn't exist: %w", ident.CommitID, ErrNotFound)
+			return
+		}
+		commitID = ident.CommitID
+	case ident.Tag != "":
+		tag, ok := meta.Tags[ident.Tag]
+		if !ok {
+			err = fmt.Errorf("tag '%s' doesn't exist: %w", ident.Tag, ErrNotFound)
+			return
+		}
+		commitID = tag.Commit
+	case ident.Release != "":
+		rel, ok := meta.Releases[ident.Release]
+		if !ok {
+			err = fmt.Errorf("release '%s' doesn't exist: %w", ident.Release, ErrNotFound)
+			return
+		}
+		commitID = rel.Commit
+	default:
+		branch := ident.Branch
+		if branch == "" {
+			branch = meta.DefBranch
+		}
+		b, ok := meta.Branches[branch]
+		if !ok {
+			err = fmt.Errorf("branch '%s' doesn't exist: %w", branch, ErrNotFound)
+			return
+		}
+		commitID = b.Commit
+	}
+	return
+}
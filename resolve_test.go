@@ -0,0 +1,50 @@
+package dbhub_test
+
+import (
+	"testing"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResolve verifies identifiers are resolved to the commit they point to
+func TestResolve(t *testing.T) {
+	srv, conn, _, commit1, commit2 := newVerifyServer(t, nil)
+	require.NoError(t, srv.AddBranch(dbhubtest.DefaultUser, "example.db", "old", commit1))
+	require.NoError(t, srv.AddRelease(dbhubtest.DefaultUser, "example.db", "v1", commit1, ""))
+
+	tests := []struct {
+		ident dbhub.Identifier
+		want  string
+	}{
+		{dbhub.Identifier{}, commit2},
+		{dbhub.Identifier{Branch: "main"}, commit2},
+		{dbhub.Identifier{Branch: "old"}, commit1},
+		{dbhub.Identifier{CommitID: commit1}, commit1},
+		{dbhub.Identifier{Release: "v1"}, commit1},
+		{dbhub.Identifier{Tag: "first"}, commit1},
+	}
+	for _, tt := range tests {
+		commitID, err := conn.Resolve(dbhubtest.DefaultUser, "example.db", tt.ident)
+		require.NoError(t, err, "%+v", tt.ident)
+		assert.Equal(t, tt.want, commitID, "%+v", tt.ident)
+	}
+
+	// Unknown branches, commits, releases, and tags
+	for _, ident := range []dbhub.Identifier{{Branch: "nope"}, {CommitID: "0123"}, {Release: "nope"}, {Tag: "nope"}} {
+		_, err := conn.Resolve(dbhubtest.DefaultUser, "example.db", ident)
+		assert.ErrorIs(t, err, dbhub.ErrNotFound, "%+v", ident)
+	}
+	_, err := conn.Resolve(dbhubtest.DefaultUser, "missing.db", dbhub.Identifier{})
+	assert.ErrorIs(t, err, dbhub.ErrNotFound)
+
+	// Identifiers naming more than one thing are rejected without asking the server
+	calls := srv.Calls("/v1/metadata")
+	_, err = conn.Resolve(dbhubtest.DefaultUser, "example.db", dbhub.Identifier{Branch: "main", Tag: "first"})
+	assert.ErrorIs(t, err, dbhub.ErrAmbiguousIdentifier)
+	assert.EqualError(t, err, "the identifier can only name one of a branch, commit, release, or tag, but it has "+
+		"branch 'main' and tag 'first': ambiguous identifier")
+	assert.Equal(t, calls, srv.Calls("/v1/metadata"))
+}
@@ -0,0 +1,144 @@
+package dbhub
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryPolicy is a reasonable retry policy for most uses.  It isn't enabled unless passed to WithRetryPolicy().
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  250 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+}
+
+// nonIdempotent holds the API end points which change data on the server.  Requests to these aren't retried unless
+// the retry policy explicitly allows it, as a failed attempt may still have been carried out by the server.
+var nonIdempotent = map[string]bool{
+	"/v1/delete":  true,
+	"/v1/execute": true,
+	"/v1/upload":  true,
+}
+
+// RetryPolicy controls how requests which fail due to a transient problem are retried.  Transient problems are
+// connection failures, and responses with a 429, 502, 503, or 504 status code.  Status code 500 isn't retried, as the
+// DBHub.io server uses it for errors which won't go away by themselves, such as invalid SQL.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made for a request, including the first one.  Values below 2
+	// disable retries.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry.  The delay doubles for each following retry, with some random
+	// jitter added so many clients don't all retry at the same moment.
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries.  Delays the server asks for with a Retry-After header are respected
+	// as long as they're no longer than this, but if the server asks for a longer wait the request fails straight away
+	// rather than blocking for it.  Zero means there's no limit.
+	MaxBackoff time.Duration
+
+	// RetryNonIdempotent allows retrying requests which change data on the server, ie Delete(), Execute(), Upload(),
+	// and UploadLive().  Only turn this on if running the change twice is harmless.
+	RetryNonIdempotent bool
+}
+
+// WithRetryPolicy makes the connection retry requests which fail due to transient problems, using the given policy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Connection) error {
+		c.retry = p
+		return nil
+	}
+}
+
+// attempts returns the maximum number of attempts to make for a request to the given end point
+func (p RetryPolicy) attempts(endpoint string) int {
+	if p.MaxAttempts < 2 || (nonIdempotent[endpoint] && !p.RetryNonIdempotent) {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns how long to wait before making the next attempt, after the given number of failed attempts.  ok is
+// false if the server asked us to wait for longer than MaxBackoff, so the request shouldn't be retried.
+func (p RetryPolicy) backoff(failed int, err error) (d time.Duration, ok bool) {
+	// If the server told us how long to wait, then do that
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if p.MaxBackoff > 0 && apiErr.RetryAfter > p.MaxBackoff {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	// Exponential backoff, with jitter covering the upper half of the delay
+	d = p.MinBackoff
+	for i := 1; i < failed && (p.MaxBackoff <= 0 || d < p.MaxBackoff) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// isTransient returns true if the error is likely to go away when retrying the request
+func isTransient(err error) bool {
+	if errors.Is(err, ErrPinMismatch) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	// Connections which were refused, reset, dropped, or timed out
+	var opErr *net.OpError
+	var netErr net.Error
+	return errors.As(err, &opErr) || (errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// parseRetryAfter returns the delay requested by a Retry-After header, which can be either a number of seconds or a
+// http date.  Zero is returned if the header is missing or can't be understood.
+func parseRetryAfter(h string, now time.Time) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// sleepContext waits for the given duration, returning early with an error if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
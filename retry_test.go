@@ -0,0 +1,150 @@
+package dbhub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRetryPolicy verifies transient failures are retried, but only for requests which are safe to retry
+func TestRetryPolicy(t *testing.T) {
+	// Create a test server which fails the first two requests to each end point
+	var tables, execs int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := &tables
+		if r.URL.Path == "/v1/execute" {
+			counter = &execs
+		}
+		if atomic.AddInt32(counter, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/v1/execute" {
+			w.Write([]byte(`{"rows_changed":1,"status":"OK"}`))
+			return
+		}
+		w.Write([]byte(`["table1"]`))
+	}))
+	defer srv.Close()
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	conn, err := New("somekey", WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	// Read only requests are retried until they succeed
+	tbls, err := conn.Tables("default", "some.sqlite", Identifier{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"table1"}, tbls)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&tables))
+
+	// Requests which change data aren't retried by default
+	_, err = conn.Execute("default", "some.sqlite", "DELETE FROM table1")
+	assert.ErrorContains(t, err, "503")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&execs))
+
+	// Unless the policy says they can be
+	policy.RetryNonIdempotent = true
+	conn.retry = policy
+	rows, err := conn.Execute("default", "some.sqlite", "DELETE FROM table1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rows)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&execs))
+}
+
+// TestRetryNotTransient verifies errors which won't go away by themselves are returned straight away
+func TestRetryNotTransient(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"near \"SELEC\": syntax error"}`))
+	}))
+	defer srv.Close()
+	conn, err := New("somekey", WithRetryPolicy(DefaultRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	_, err = conn.Query("default", "some.sqlite", Identifier{}, false, "SELEC 1")
+	assert.EqualError(t, err, `near "SELEC": syntax error`)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+// TestRetryAfterTooLong verifies requests fail straight away when the server asks for a longer wait than MaxBackoff
+func TestRetryAfterTooLong(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	conn, err := New("somekey", WithRetryPolicy(DefaultRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	start := time.Now()
+	_, err = conn.Tables("default", "some.sqlite", Identifier{})
+	assert.Less(t, time.Since(start), 5*time.Second)
+	var apiErr *APIError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, time.Hour, apiErr.RetryAfter)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+// TestRetryBackoff verifies the delays between attempts
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for failed, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 5: time.Second} {
+		d, ok := p.backoff(failed, nil)
+		assert.True(t, ok)
+		assert.GreaterOrEqual(t, d, max/2)
+		assert.LessOrEqual(t, d, max)
+	}
+
+	// Without a MaxBackoff the delay keeps growing, without overflowing for large numbers of failures
+	unlimited := RetryPolicy{MinBackoff: 100 * time.Millisecond}
+	for failed := 1; failed <= 4; failed++ {
+		max := 100 * time.Millisecond << (failed - 1)
+		d, ok := unlimited.backoff(failed, nil)
+		assert.True(t, ok)
+		assert.GreaterOrEqual(t, d, max/2, "failed %d", failed)
+		assert.LessOrEqual(t, d, max, "failed %d", failed)
+	}
+	d, ok := unlimited.backoff(100, nil)
+	assert.True(t, ok)
+	assert.Greater(t, d, time.Duration(0))
+
+	// A Retry-After from the server takes precedence, as long as it's not longer than MaxBackoff
+	d, ok = p.backoff(1, &APIError{RetryAfter: 500 * time.Millisecond})
+	assert.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, d)
+	_, ok = p.backoff(1, &APIError{RetryAfter: 30 * time.Second})
+	assert.False(t, ok)
+
+	// Without a MaxBackoff, any delay the server asks for is respected
+	p.MaxBackoff = 0
+	d, ok = p.backoff(1, &APIError{RetryAfter: 30 * time.Second})
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, d)
+}
+
+// TestParseRetryAfter verifies both forms of the Retry-After header are understood
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("-5", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+}
@@ -0,0 +1,244 @@
+package dbhub
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFormats holds the layouts tried when storing a text value into a time.Time field.  They're the formats understood
+// by the SQLite date and time functions.
+var timeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// QueryAs runs a SQL query (SELECT only) on the chosen database, returning the result rows as a slice of T.  See
+// TypedResults.Scan() for how the columns are matched up to the fields of T.
+func QueryAs[T any](ctx context.Context, c Connection, dbOwner, dbName string, ident Identifier, sql string) (out []T, err error) {
+	err = c.QueryIntoContext(ctx, dbOwner, dbName, ident, sql, &out)
+	return
+}
+
+// Scan stores the result rows in dest, which must be a pointer to a slice.  When the slice elements are structs (or
+// pointers to structs), each column is stored in the field with a matching `dbhub:"name"` tag, or otherwise in the
+// field with the same name ignoring case.  Fields tagged with `dbhub:"-"` are skipped, as are columns with no matching
+// field.  When the slice elements aren't structs, the results must have exactly one column.
+//
+// NULL values can only be stored in pointer, interface, slice, and sql.Scanner (eg sql.NullInt64) fields.  BLOBs can
+// be stored in []byte fields, and text values in time.Time fields if they use one of the SQLite date formats.
+func (r TypedResults) Scan(dest interface{}) error {
+	sliceVal := reflect.ValueOf(dest)
+	if sliceVal.Kind() != reflect.Ptr || sliceVal.IsNil() || sliceVal.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("destination must be a non nil pointer to a slice, not %T", dest)
+	}
+	sliceVal = sliceVal.Elem()
+	elemType := sliceVal.Type().Elem()
+	baseType := elemType
+	if baseType.Kind() == reflect.Ptr {
+		baseType = baseType.Elem()
+	}
+
+	// Work out which field (if any) each of the columns is stored in
+	var fields [][]int
+	isStruct := baseType.Kind() == reflect.Struct && !isScanTarget(baseType)
+	if isStruct {
+		fields = columnFields(baseType, r.Columns)
+	} else if len(r.Columns) > 1 {
+		return fmt.Errorf("can't store %d columns in a slice of %s", len(r.Columns), elemType)
+	}
+
+	// Store the rows
+	rows := reflect.MakeSlice(sliceVal.Type(), 0, len(r.Rows))
+	for i, row := range r.Rows {
+		// Non struct values are stored directly in the slice element, so pointers can be used for NULLs
+		if !isStruct {
+			elem := reflect.New(elemType).Elem()
+			if len(row) > 0 {
+				if err := storeValue(elem, row[0]); err != nil {
+					return fmt.Errorf("column '%s' of row %d: %w", r.Columns[0].Name, i, err)
+				}
+			}
+			rows = reflect.Append(rows, elem)
+			continue
+		}
+
+		elem := reflect.New(baseType).Elem()
+		for j, v := range row {
+			if fields[j] == nil {
+				continue
+			}
+			if err := storeValue(elem.FieldByIndex(fields[j]), v); err != nil {
+				return fmt.Errorf("column '%s' of row %d: %w", r.Columns[j].Name, i, err)
+			}
+		}
+		if elemType.Kind() == reflect.Ptr {
+			elem = elem.Addr()
+		}
+		rows = reflect.Append(rows, elem)
+	}
+	sliceVal.Set(rows)
+	return nil
+}
+
+// columnFields returns the index of the struct field each column should be stored in, or nil for columns with no
+// matching field
+func columnFields(t reflect.Type, cols []ResultColumn) [][]int {
+	tagged := make(map[string][]int)
+	named := make(map[string][]int)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous || throughPointer(t, f.Index) {
+			continue
+		}
+		tag := f.Tag.Get("dbhub")
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			tagged[tag] = f.Index
+		} else {
+			named[strings.ToLower(f.Name)] = f.Index
+		}
+	}
+	fields := make([][]int, len(cols))
+	for i, col := range cols {
+		if idx, ok := tagged[col.Name]; ok {
+			fields[i] = idx
+		} else {
+			fields[i] = named[strings.ToLower(col.Name)]
+		}
+	}
+	return fields
+}
+
+// throughPointer returns true if reaching the field at the given index means following an embedded struct pointer
+func throughPointer(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		t = t.Field(i).Type
+		if t.Kind() == reflect.Ptr {
+			return true
+		}
+	}
+	return false
+}
+
+// isScanTarget returns true for struct types which are stored into as a single value, rather than field by field
+func isScanTarget(t reflect.Type) bool {
+	return t == reflect.TypeOf(time.Time{}) || reflect.PtrTo(t).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem())
+}
+
+// storeValue stores a query result value (int64, float64, string, []byte, or nil) in dst
+func storeValue(dst reflect.Value, v interface{}) error {
+	// Types which know how to store values themselves, eg sql.NullString
+	if scanner, ok := dst.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(v)
+	}
+
+	// Pointers are left nil for NULLs, and otherwise point to a new value
+	if dst.Kind() == reflect.Ptr {
+		if v == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		p := reflect.New(dst.Type().Elem())
+		if err := storeValue(p.Elem(), v); err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+	}
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		if v == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+		} else {
+			dst.Set(reflect.ValueOf(v))
+		}
+		return nil
+	}
+
+	switch val := v.(type) {
+	case nil:
+		if dst.Kind() == reflect.Slice || dst.Kind() == reflect.Map {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+	case int64:
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(val) {
+				return fmt.Errorf("value %d overflows %s", val, dst.Type())
+			}
+			dst.SetInt(val)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if val < 0 || dst.OverflowUint(uint64(val)) {
+				return fmt.Errorf("value %d overflows %s", val, dst.Type())
+			}
+			dst.SetUint(uint64(val))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(val))
+			return nil
+		case reflect.Bool:
+			dst.SetBool(val != 0)
+			return nil
+		case reflect.String:
+			dst.SetString(strconv.FormatInt(val, 10))
+			return nil
+		}
+	case float64:
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(val)
+			return nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if val != math.Trunc(val) || dst.OverflowInt(int64(val)) {
+				return fmt.Errorf("value %v can't be stored in %s", val, dst.Type())
+			}
+			dst.SetInt(int64(val))
+			return nil
+		case reflect.String:
+			dst.SetString(strconv.FormatFloat(val, 'g', -1, 64))
+			return nil
+		}
+	case string:
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(val)
+			return nil
+		case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetBytes([]byte(val))
+			return nil
+		case dst.Type() == reflect.TypeOf(time.Time{}):
+			for _, layout := range timeFormats {
+				if t, err := time.Parse(layout, val); err == nil {
+					dst.Set(reflect.ValueOf(t))
+					return nil
+				}
+			}
+			return fmt.Errorf("unknown date format for value '%s'", val)
+		}
+	case []byte:
+		switch {
+		case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetBytes(append([]byte(nil), val...))
+			return nil
+		case dst.Kind() == reflect.String:
+			dst.SetString(string(val))
+			return nil
+		}
+	}
+	if v == nil {
+		return fmt.Errorf("can't store NULL in %s, use a pointer or sql.Null type instead", dst.Type())
+	}
+	return fmt.Errorf("can't store value of type %T in %s", v, dst.Type())
+}
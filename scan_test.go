@@ -0,0 +1,105 @@
+package dbhub
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScan verifies query results are stored in struct fields, matching by tag or field name
+func TestScan(t *testing.T) {
+	type base struct {
+		ID int `dbhub:"id"`
+	}
+	type row struct {
+		base
+		Name    string
+		Score   sql.NullFloat64 `dbhub:"score"`
+		Parent  *int64          `dbhub:"parent_id"`
+		Data    []byte
+		Created time.Time
+		Skipped string `dbhub:"-"`
+	}
+	results := TypedResults{
+		Columns: []ResultColumn{{"id", Integer}, {"NAME", Text}, {"score", Float}, {"parent_id", Integer},
+			{"data", Binary}, {"created", Text}, {"skipped", Text}, {"unknown", Text}},
+		Rows: [][]interface{}{
+			{int64(1), "Foo", 2.5, int64(7), []byte{1, 2}, "2024-01-02 03:04:05", "x", "y"},
+			{int64(2), "Bar", nil, nil, nil, "2024-01-03", "x", "y"},
+		},
+	}
+
+	// Store the results in a slice of structs
+	var rows []row
+	if err := results.Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, rows, 2) {
+		seven := int64(7)
+		assert.Equal(t, row{base: base{ID: 1}, Name: "Foo", Score: sql.NullFloat64{Float64: 2.5, Valid: true},
+			Parent: &seven, Data: []byte{1, 2}, Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, rows[0])
+		assert.Equal(t, row{base: base{ID: 2}, Name: "Bar", Created: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)}, rows[1])
+	}
+
+	// Slices of struct pointers work too
+	var ptrs []*row
+	if assert.NoError(t, results.Scan(&ptrs)) && assert.Len(t, ptrs, 2) {
+		assert.Equal(t, "Bar", ptrs[1].Name)
+	}
+}
+
+// TestScanErrors verifies values which can't be stored are reported, rather than silently lost
+func TestScanErrors(t *testing.T) {
+	type row struct {
+		ID   int8
+		Name string
+	}
+
+	// NULL into a field which can't hold it
+	var rows []row
+	err := TypedResults{Columns: []ResultColumn{{"name", Text}}, Rows: [][]interface{}{{nil}}}.Scan(&rows)
+	assert.EqualError(t, err, "column 'name' of row 0: can't store NULL in string, use a pointer or sql.Null type instead")
+
+	// Integers too large for the field
+	err = TypedResults{Columns: []ResultColumn{{"id", Integer}}, Rows: [][]interface{}{{int64(300)}}}.Scan(&rows)
+	assert.EqualError(t, err, "column 'id' of row 0: value 300 overflows int8")
+
+	// Destinations which aren't a pointer to a slice
+	assert.Error(t, TypedResults{}.Scan(rows))
+
+	// Several columns into a slice of non structs
+	var names []string
+	err = TypedResults{Columns: []ResultColumn{{"id", Integer}, {"name", Text}}}.Scan(&names)
+	assert.EqualError(t, err, "can't store 2 columns in a slice of string")
+}
+
+// TestQueryAs verifies the generic query function returns the rows as the requested type
+func TestQueryAs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[[{"Name":"Name","Type":3,"Value":"Bar"}],[{"Name":"Name","Type":2,"Value":null}]]`))
+	}))
+	defer srv.Close()
+	conn, err := New("somekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ChangeServer(srv.URL)
+
+	// Single column results can be returned as a slice of plain values
+	names, err := QueryAs[*string](context.Background(), conn, "default", "some.sqlite", Identifier{}, "SELECT Name FROM table1")
+	if assert.NoError(t, err) && assert.Len(t, names, 2) {
+		assert.Equal(t, "Bar", *names[0])
+		assert.Nil(t, names[1])
+	}
+
+	// Or as structs
+	type row struct{ Name sql.NullString }
+	rows, err := QueryAs[row](context.Background(), conn, "default", "some.sqlite", Identifier{}, "SELECT Name FROM table1")
+	assert.NoError(t, err)
+	assert.Equal(t, []row{{sql.NullString{String: "Bar", Valid: true}}, {}}, rows)
+}
@@ -0,0 +1,147 @@
+package dbhub
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The options in this file change the TLS settings used when talking to the server.  They're meant for self-hosted
+// DBHub.io servers, so their certificates can be checked properly rather than turning off verification with
+// ChangeVerifyServerCert().  As with ChangeVerifyServerCert(), they have no effect on a caller provided client or
+// transport.
+
+// WithCACertFile makes the connection trust only the certificate authorities in the given PEM file when checking the
+// server's certificate, instead of the system ones
+func WithCACertFile(path string) Option {
+	return withTLSConfig(func(cfg *tls.Config) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if cfg.RootCAs, err = certPool(data); err != nil {
+			return fmt.Errorf("%w in the CA file %s", err, path)
+		}
+		return nil
+	})
+}
+
+// WithCACerts is like WithCACertFile(), but takes the PEM encoded certificates directly
+func WithCACerts(pemCerts []byte) Option {
+	return withTLSConfig(func(cfg *tls.Config) (err error) {
+		cfg.RootCAs, err = certPool(pemCerts)
+		return
+	})
+}
+
+// certPool returns a pool holding the certificates in PEM data
+func certPool(pemCerts []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemCerts) {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return pool, nil
+}
+
+// WithClientCert makes the connection present a client certificate to the server, for servers behind proxies which
+// require mutual TLS.  The certificate and key are read from PEM files.  keyFile can be empty if the key is in
+// certFile too.
+func WithClientCert(certFile, keyFile string) Option {
+	if keyFile == "" {
+		keyFile = certFile
+	}
+	return withTLSConfig(func(cfg *tls.Config) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("loading the client certificate failed: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+		return nil
+	})
+}
+
+// WithClientCertificate is like WithClientCert(), but takes an already loaded certificate
+func WithClientCertificate(cert tls.Certificate) Option {
+	return withTLSConfig(func(cfg *tls.Config) error {
+		cfg.Certificates = []tls.Certificate{cert}
+		return nil
+	})
+}
+
+// WithPinnedKeys makes the connection refuse servers whose certificate chain doesn't hold one of the given public
+// keys, returning ErrPinMismatch instead.  Each pin is the base64 encoded SHA256 hash of a certificate's
+// SubjectPublicKeyInfo, optionally starting with "sha256//" as used by curl's --pinnedpubkey.  It can be created
+// with:
+//
+//	openssl x509 -in cert.pem -noout -pubkey | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+//
+// When the server certificate is verified, the pins can match any certificate in the verified chain, such as that of
+// an intermediate certificate authority.  When verification is turned off with ChangeVerifyServerCert(), only the
+// server's own certificate is checked, as nothing else it sends can be trusted.
+func WithPinnedKeys(pins ...string) Option {
+	hashes := make(map[[sha256.Size]byte]bool, len(pins))
+	var pinErr error
+	for _, pin := range pins {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256//"))
+		if err != nil || len(b) != sha256.Size {
+			pinErr = fmt.Errorf("the pinned key '%s' isn't a base64 encoded SHA256 hash", pin)
+			break
+		}
+		var h [sha256.Size]byte
+		copy(h[:], b)
+		hashes[h] = true
+	}
+	return withTLSConfig(func(cfg *tls.Config) error {
+		if pinErr != nil {
+			return pinErr
+		}
+		if len(hashes) == 0 {
+			return fmt.Errorf("no pinned keys given")
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return ErrPinMismatch
+			}
+			certs := []*x509.Certificate{cs.PeerCertificates[0]}
+			for _, chain := range cs.VerifiedChains {
+				certs = append(certs, chain...)
+			}
+			for _, cert := range certs {
+				if hashes[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+					return nil
+				}
+			}
+			return ErrPinMismatch
+		}
+		return nil
+	})
+}
+
+// tlsClients holds the http clients of a connection with its own TLS settings.  There's one which verifies the server
+// certificate and one which doesn't, so ChangeVerifyServerCert() keeps working.
+type tlsClients struct {
+	config   *tls.Config
+	verify   *http.Client
+	insecure *http.Client
+}
+
+// withTLSConfig returns an Option which changes the TLS settings of the connection, building on any changed by
+// earlier options
+func withTLSConfig(change func(cfg *tls.Config) error) Option {
+	return func(c *Connection) error {
+		cfg := &tls.Config{}
+		if c.tls != nil {
+			cfg = c.tls.config.Clone()
+		}
+		if err := change(cfg); err != nil {
+			return err
+		}
+		c.tls = &tlsClients{config: cfg, verify: newHTTPClient(true, cfg), insecure: newHTTPClient(false, cfg)}
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+package dbhub_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTLSServer starts a https server answering every request with a list of databases.  If clientCAs is given, the
+// server requires a client certificate signed by one of them.
+func newTLSServer(t *testing.T, clientCAs *x509.CertPool) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["example.db"]`))
+	}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	if clientCAs != nil {
+		srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// serverPEM returns the certificate of a test server, PEM encoded
+func serverPEM(srv *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+}
+
+// tlsConn returns a connection to a test server
+func tlsConn(t *testing.T, srv *httptest.Server, opts ...dbhub.Option) dbhub.Connection {
+	conn, err := dbhub.New("key", opts...)
+	require.NoError(t, err)
+	conn.ChangeServer(srv.URL)
+	return conn
+}
+
+// newClientCert creates a self signed client certificate, returning it along with its PEM encoding and that of its key
+func newClientCert(t *testing.T) (cert *x509.Certificate, certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dbhub client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+// TestCACerts verifies trusting a server's certificate authority
+func TestCACerts(t *testing.T) {
+	srv := newTLSServer(t, nil)
+	_, err := tlsConn(t, srv).Databases()
+	assert.Error(t, err)
+	dbs, err := tlsConn(t, srv, dbhub.WithCACerts(serverPEM(srv))).Databases()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.db"}, dbs)
+
+	// Turning verification off still works alongside the custom settings
+	_, otherPEM, _ := newClientCert(t)
+	conn := tlsConn(t, srv, dbhub.WithCACerts(otherPEM))
+	_, err = conn.Databases()
+	assert.Error(t, err)
+	conn.ChangeVerifyServerCert(false)
+	_, err = conn.Databases()
+	assert.NoError(t, err)
+
+	_, err = dbhub.New("key", dbhub.WithCACerts([]byte("not a certificate")))
+	assert.EqualError(t, err, "no certificates found")
+}
+
+// TestClientCert verifies presenting a client certificate to servers which require one
+func TestClientCert(t *testing.T) {
+	// Save a self signed client certificate in PEM files
+	cert, certPEM, keyPEM := newClientCert(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0600))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	srv := newTLSServer(t, pool)
+	ca := dbhub.WithCACerts(serverPEM(srv))
+	_, err := tlsConn(t, srv, ca).Databases()
+	assert.Error(t, err)
+	_, err = tlsConn(t, srv, ca, dbhub.WithClientCert(certFile, keyFile)).Databases()
+	assert.NoError(t, err)
+
+	// The key can be in the same file as the certificate
+	both := filepath.Join(dir, "both.pem")
+	require.NoError(t, os.WriteFile(both, append(certPEM, keyPEM...), 0600))
+	_, err = tlsConn(t, srv, dbhub.WithClientCert(both, ""), ca).Databases()
+	assert.NoError(t, err)
+
+	_, err = dbhub.New("key", dbhub.WithClientCert(keyFile, ""))
+	assert.ErrorContains(t, err, "loading the client certificate failed: ")
+}
+
+// TestPinnedKeys verifies servers are only accepted when their certificate holds one of the pinned keys
+func TestPinnedKeys(t *testing.T) {
+	srv := newTLSServer(t, nil)
+	hash := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(hash[:])
+	otherHash := sha256.Sum256([]byte("some other key"))
+	otherPin := base64.StdEncoding.EncodeToString(otherHash[:])
+	ca := dbhub.WithCACerts(serverPEM(srv))
+
+	_, err := tlsConn(t, srv, ca, dbhub.WithPinnedKeys(otherPin, "sha256//"+pin)).Databases()
+	assert.NoError(t, err)
+	_, err = tlsConn(t, srv, ca, dbhub.WithPinnedKeys(otherPin)).Databases()
+	assert.ErrorIs(t, err, dbhub.ErrPinMismatch)
+
+	// Pins are still checked when the certificate isn't verified, and aren't retried
+	conn := tlsConn(t, srv, dbhub.WithPinnedKeys(pin))
+	conn.ChangeVerifyServerCert(false)
+	_, err = conn.Databases()
+	assert.NoError(t, err)
+	conn = tlsConn(t, srv, dbhub.WithPinnedKeys(otherPin), dbhub.WithRetryPolicy(dbhub.DefaultRetryPolicy))
+	conn.ChangeVerifyServerCert(false)
+	_, err = conn.Databases()
+	assert.ErrorIs(t, err, dbhub.ErrPinMismatch)
+
+	// Pins are taken as they are, even when their base64 starts with "/"
+	slashPin := base64.StdEncoding.EncodeToString(append([]byte{0xfc}, make([]byte, sha256.Size-1)...))
+	require.Equal(t, byte('/'), slashPin[0])
+	_, err = tlsConn(t, srv, ca, dbhub.WithPinnedKeys(slashPin, pin)).Databases()
+	assert.NoError(t, err)
+	_, err = tlsConn(t, srv, ca, dbhub.WithPinnedKeys("sha256//"+slashPin)).Databases()
+	assert.ErrorIs(t, err, dbhub.ErrPinMismatch)
+
+	_, err = dbhub.New("key", dbhub.WithPinnedKeys("c2hvcnQ="))
+	assert.EqualError(t, err, "the pinned key 'c2hvcnQ=' isn't a base64 encoded SHA256 hash")
+	_, err = dbhub.New("key", dbhub.WithPinnedKeys())
+	assert.EqualError(t, err, "no pinned keys given")
+}
@@ -1,12 +1,47 @@
 package dbhub
 
-import "time"
+import (
+	"net/http"
+	"time"
+)
 
 // Connection is a simple container holding the API key and address of the DBHub.io server
 type Connection struct {
 	APIKey           string `json:"api_key"`
 	Server           string `json:"server"`
 	VerifyServerCert bool   `json:"verify_certificate"`
+
+	// httpClient is the caller provided client, if any.  It, the limiter, the cache, and the clients with custom TLS
+	// settings are shared between copies of the Connection.  Options which can't be compared, such as functions, are
+	// kept behind the opts pointer so Connection values stay comparable.
+	httpClient *http.Client
+	tls        *tlsClients
+	limiter    *limiter
+	cache      *cache
+	retry      RetryPolicy
+	opts       *connOptions
+}
+
+// connOptions holds the connection options which aren't comparable.  It's never changed once set, as copies of the
+// Connection may share it.
+type connOptions struct {
+	progress     ProgressFunc
+	interceptors []Interceptor
+}
+
+// options returns the connection options which aren't comparable
+func (c Connection) options() connOptions {
+	if c.opts == nil {
+		return connOptions{}
+	}
+	return *c.opts
+}
+
+// setOptions changes the connection options which aren't comparable, by replacing them with an updated copy
+func (c *Connection) setOptions(f func(o *connOptions)) {
+	o := c.options()
+	f(&o)
+	c.opts = &o
 }
 
 // Identifier holds information used to identify a specific commit, tag, release, or the head of a specific branch
@@ -50,6 +85,25 @@ type Results struct {
 	Rows []ResultRow
 }
 
+// ResultColumn holds the name and type of a column in the results of a SQL query.  As SQLite columns can hold values of
+// any type, the type is taken from the first non NULL value in the column.
+type ResultColumn struct {
+	Name string
+	Type ValType
+}
+
+// TypedResults is used for returning the results of a SQL query with their native types.  Each value in the rows is an
+// int64, float64, string, []byte (for BLOBs), or nil (for NULLs).
+//
+// The server doesn't send a header with the column names, so they're taken from the first row.  A query which returns
+// no rows has no Columns either.  BLOBs are sent by the server as JSON strings, so any bytes in them which aren't
+// valid UTF-8 are replaced with U+FFFD (the bytes EF BF BD) before they reach us.  BLOBs holding arbitrary binary data
+// should be selected with hex() or base64 encoded in the query instead, and decoded by the caller.
+type TypedResults struct {
+	Columns []ResultColumn
+	Rows    [][]interface{}
+}
+
 // UploadInformation holds information used when uploading
 type UploadInformation struct {
 	Ident           Identifier `json:"identifier"`
@@ -0,0 +1,291 @@
+package dbhub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errNotRewindable is returned when a retry needs to send an upload body again, but it can't be read a second time
+var errNotRewindable = errors.New("the upload body can't be read again")
+
+// UploadReader uploads a new standard database, or a new revision of an existing one, reading the database from r.
+// The database is streamed to the server rather than held in memory, so it works for databases of any size.  size is
+// the number of bytes r will provide, or -1 if it isn't known in advance.
+//
+// The SHA256 of the database is calculated as it's sent, and returned as a hex string once the upload succeeds.  If
+// info.ShaSum is empty, the calculated SHA256 is included with the upload so the server can check the database arrived
+// intact.
+//
+// A failed upload can only be retried (see RetryPolicy.RetryNonIdempotent) if r is also an io.Seeker, as the
+// database needs to be read again.
+func (c Connection) UploadReader(ctx context.Context, dbName string, info UploadInformation, r io.Reader, size int64) (shaSum string, err error) {
+	data := uploadVals(c.PrepareVals("", dbName, info.Ident), info)
+	return c.uploadStream(ctx, data, readerOpener(r), size)
+}
+
+// UploadFile uploads a new standard database, or a new revision of an existing one, from a database file on disk.  If
+// dbName is empty, the name of the file is used.  See UploadReader for details.
+func (c Connection) UploadFile(ctx context.Context, dbName string, info UploadInformation, path string) (shaSum string, err error) {
+	if dbName == "" {
+		dbName = filepath.Base(path)
+	}
+	open, size, err := fileOpener(path)
+	if err != nil {
+		return
+	}
+	data := uploadVals(c.PrepareVals("", dbName, info.Ident), info)
+	return c.uploadStream(ctx, data, open, size)
+}
+
+// UploadLiveReader uploads a new Live database, streaming it from r.  See UploadReader for details.
+func (c Connection) UploadLiveReader(ctx context.Context, dbName string, r io.Reader, size int64) (shaSum string, err error) {
+	data := c.PrepareVals("", dbName, Identifier{})
+	data.Set("live", "true")
+	return c.uploadStream(ctx, data, readerOpener(r), size)
+}
+
+// UploadLiveFile uploads a new Live database from a database file on disk.  If dbName is empty, the name of the file
+// is used.  See UploadReader for details.
+func (c Connection) UploadLiveFile(ctx context.Context, dbName string, path string) (shaSum string, err error) {
+	if dbName == "" {
+		dbName = filepath.Base(path)
+	}
+	open, size, err := fileOpener(path)
+	if err != nil {
+		return
+	}
+	data := c.PrepareVals("", dbName, Identifier{})
+	data.Set("live", "true")
+	return c.uploadStream(ctx, data, open, size)
+}
+
+// uploadVals adds the commit details of a standard database upload to the API parameters
+func uploadVals(data url.Values, info UploadInformation) url.Values {
+	data.Del("dbowner") // The upload function always stores the database in the account of the API key user
+	if info.CommitMsg != "" {
+		data.Set("commitmsg", info.CommitMsg)
+	}
+	if info.SourceURL != "" {
+		data.Set("sourceurl", info.SourceURL)
+	}
+	if !info.LastModified.IsZero() {
+		data.Set("lastmodified", info.LastModified.Format(time.RFC3339))
+	}
+	if info.Licence != "" {
+		data.Set("licence", info.Licence)
+	}
+	if info.Public != "" {
+		data.Set("public", info.Public)
+	}
+	if info.Force {
+		data.Set("force", "true")
+	}
+	if !info.CommitTimestamp.IsZero() {
+		data.Set("committimestamp", info.CommitTimestamp.Format(time.RFC3339))
+	}
+	if info.AuthorName != "" {
+		data.Set("authorname", info.AuthorName)
+	}
+	if info.AuthorEmail != "" {
+		data.Set("authoremail", info.AuthorEmail)
+	}
+	if info.CommitterName != "" {
+		data.Set("committername", info.CommitterName)
+	}
+	if info.CommitterEmail != "" {
+		data.Set("committeremail", info.CommitterEmail)
+	}
+	if info.OtherParents != "" {
+		data.Set("otherparents", info.OtherParents)
+	}
+	if info.ShaSum != "" {
+		data.Set("dbshasum", info.ShaSum)
+	}
+	return data
+}
+
+// uploadStream uploads a database, returning its SHA256.  The SHA256 is sent with the upload if the caller didn't
+// provide one.
+func (c Connection) uploadStream(ctx context.Context, data url.Values, open func() (io.ReadCloser, error), size int64) (shaSum string, err error) {
+	var body io.ReadCloser
+	body, shaSum, err = c.sendUploadStream(ctx, "/v1/upload", data, open, size, data.Get("dbshasum") == "")
+	if err != nil {
+		return
+	}
+	body.Close()
+	return
+}
+
+// readerOpener returns a function giving the contents of r for each upload attempt.  Readers which can't seek can
+// only be used once.
+func readerOpener(r io.Reader) func() (io.ReadCloser, error) {
+	seeker, canSeek := r.(io.Seeker)
+	var start int64
+	if canSeek {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			canSeek = false
+		}
+	}
+	used := false
+	return func() (io.ReadCloser, error) {
+		if used {
+			if !canSeek {
+				return nil, errNotRewindable
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		used = true
+		return io.NopCloser(r), nil
+	}
+}
+
+// fileOpener returns a function opening a file for each upload attempt, along with the size of the file
+func fileOpener(path string) (open func() (io.ReadCloser, error), size int64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if !info.Mode().IsRegular() {
+		err = fmt.Errorf("'%s' isn't a regular file", path)
+		return
+	}
+	size = info.Size()
+	open = func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+	return
+}
+
+// sendUploadStream uploads a database to DBHub.io, streaming the multi-part body through a pipe so the database is
+// never held in memory.  open is called to get the database contents for each attempt.  When size is known the
+// request has a Content-Length, otherwise it's sent chunked.  The SHA256 of the database is calculated as it's sent
+// and returned, and if addShaSum is set it's also added to the end of the body as the dbshasum field.
+func (c Connection) sendUploadStream(ctx context.Context, endpoint string, data url.Values, open func() (io.ReadCloser, error), size int64, addShaSum bool) (body io.ReadCloser, shaSum string, err error) {
+	fileName := data.Get("dbname")
+	if fileName == "" {
+		fileName = "database.db"
+	}
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	// Work out the full length of the body, by writing everything except the database itself
+	length := int64(-1)
+	if size >= 0 {
+		var overhead countingWriter
+		_, err = writeUploadBody(&overhead, boundary, data, fileName, strings.NewReader(""), -1, addShaSum)
+		if err != nil {
+			return
+		}
+		length = int64(overhead) + size
+	}
+
+	// Upload the database.  Each attempt's SHA256 is passed back on its own channel once its body has been written.
+	var resp *http.Response
+	var sums chan string
+	resp, err = c.do(ctx, endpoint, data, http.StatusCreated, func() (req *http.Request, err error) {
+		var src io.ReadCloser
+		src, err = open()
+		if err != nil {
+			return
+		}
+		pr, pw := io.Pipe()
+		sums = make(chan string, 1)
+		written := make(chan struct{})
+		go func(sums chan<- string) {
+			r := newProgressReader(src, c.options().progress, endpoint, data.Get("dbname"), 0, size)
+			sum, err := writeUploadBody(pw, boundary, data, fileName, r, size, addShaSum)
+			close(written)
+			pw.CloseWithError(err)
+			src.Close()
+			sums <- sum
+		}(sums)
+
+		// If reading the database stalls, the http transport waits on the pipe even once ctx is cancelled.  So the
+		// pipe is closed as well, letting the request finish.
+		go func() {
+			select {
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+			case <-written:
+			}
+		}()
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.Server+endpoint, pr)
+		if err != nil {
+			pr.CloseWithError(err)
+			return
+		}
+		req.ContentLength = length
+		req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+		return
+	})
+	if err != nil {
+		return
+	}
+	body = resp.Body
+
+	// The server has accepted the whole body, so the goroutine writing it has finished or is about to
+	shaSum = <-sums
+	return
+}
+
+// writeUploadBody writes the multi-part body of an upload, returning the SHA256 of the database.  If size isn't -1,
+// it's an error for src to provide a different number of bytes.
+func writeUploadBody(w io.Writer, boundary string, data url.Values, fileName string, src io.Reader, size int64, addShaSum bool) (shaSum string, err error) {
+	mw := multipart.NewWriter(w)
+	if err = mw.SetBoundary(boundary); err != nil {
+		return
+	}
+
+	// Send the database file, hashing it on the way
+	var part io.Writer
+	part, err = mw.CreateFormFile("file", fileName)
+	if err != nil {
+		return
+	}
+	h := sha256.New()
+	var n int64
+	n, err = io.Copy(io.MultiWriter(part, h), src)
+	if err != nil {
+		return
+	}
+	if size >= 0 && n != size {
+		err = fmt.Errorf("the database was expected to be %d bytes, but %d bytes were read", size, n)
+		return
+	}
+	shaSum = hex.EncodeToString(h.Sum(nil))
+
+	// Add the other fields
+	for name, values := range data {
+		if err = mw.WriteField(name, values[0]); err != nil {
+			return
+		}
+	}
+	if addShaSum {
+		if err = mw.WriteField("dbshasum", shaSum); err != nil {
+			return
+		}
+	}
+	err = mw.Close()
+	return
+}
+
+// countingWriter counts the bytes written to it, throwing them away
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,162 @@
+package dbhub_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sqlitebrowser/go-dbhub"
+	"github.com/sqlitebrowser/go-dbhub/dbhubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bodyRecorder is a http.RoundTripper which keeps a copy of each request body, and the request content length
+type bodyRecorder struct {
+	body          bytes.Buffer
+	contentLength int64
+}
+
+func (b *bodyRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.body.Reset()
+	b.contentLength = req.ContentLength
+	if req.Body != nil {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(req.Body, &b.body), req.Body}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// TestUploadReader verifies streaming uploads, including the automatically calculated SHA256
+func TestUploadReader(t *testing.T) {
+	srv := dbhubtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+	rec := &bodyRecorder{}
+	conn, err := srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithTransport(rec))
+	require.NoError(t, err)
+
+	dbBytes, err := os.ReadFile(filepath.Join("examples", "upload", "example.db"))
+	require.NoError(t, err)
+	sum := sha256.Sum256(dbBytes)
+	sha := hex.EncodeToString(sum[:])
+
+	// Hide the Seek method of the reader, to check readers which can only be used once work
+	r := struct{ io.Reader }{bytes.NewReader(dbBytes)}
+	shaSum, err := conn.UploadReader(ctx, "example.db", dbhub.UploadInformation{CommitMsg: "Streamed"}, r,
+		int64(len(dbBytes)))
+	require.NoError(t, err)
+	assert.Equal(t, sha, shaSum)
+	assert.Contains(t, rec.body.String(), sha)
+	assert.Equal(t, int64(rec.body.Len()), rec.contentLength)
+
+	commits, err := conn.Commits(dbhubtest.DefaultUser, "example.db")
+	require.NoError(t, err)
+	require.Len(t, commits, 1)
+	for _, c := range commits {
+		assert.Equal(t, "Streamed", c.Message)
+		assert.Equal(t, sha, c.Tree.Entries[0].Sha256)
+	}
+
+	// Unknown sizes are sent chunked
+	r = struct{ io.Reader }{bytes.NewReader(dbBytes)}
+	shaSum, err = conn.UploadLiveReader(ctx, "live.db", r, -1)
+	require.NoError(t, err)
+	assert.Equal(t, sha, shaSum)
+	assert.Equal(t, int64(-1), rec.contentLength)
+
+	// A size which doesn't match the data is an error
+	_, err = conn.UploadReader(ctx, "short.db", dbhub.UploadInformation{}, bytes.NewReader(dbBytes), int64(len(dbBytes))+1)
+	assert.Error(t, err)
+
+	// So is a checksum which doesn't match
+	_, err = conn.UploadReader(ctx, "bad.db", dbhub.UploadInformation{ShaSum: "abc"}, bytes.NewReader(dbBytes), -1)
+	assert.Error(t, err)
+}
+
+// TestUploadReaderCancelled verifies cancelling the context of an upload part way through returns straight away
+func TestUploadReaderCancelled(t *testing.T) {
+	srv := dbhubtest.NewServer()
+	defer srv.Close()
+	conn, err := srv.Connection(dbhubtest.DefaultAPIKey)
+	require.NoError(t, err)
+
+	// Send the start of a database, and then stall
+	r, w := io.Pipe()
+	defer w.Close()
+	go w.Write(make([]byte, 4096))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = conn.UploadReader(ctx, "stalled.db", dbhub.UploadInformation{}, r, 1<<20)
+	assert.True(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	dbs, err := conn.Databases()
+	require.NoError(t, err)
+	assert.NotContains(t, dbs, "stalled.db")
+}
+
+// TestUploadFile verifies uploading database files from disk, and retrying them
+func TestUploadFile(t *testing.T) {
+	srv := dbhubtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+	policy := dbhub.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, RetryNonIdempotent: true}
+	conn, err := srv.Connection(dbhubtest.DefaultAPIKey, dbhub.WithRetryPolicy(policy))
+	require.NoError(t, err)
+
+	path := filepath.Join("examples", "upload", "example.db")
+	dbBytes, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// Files are opened again for each attempt
+	srv.Script("/v1/upload", dbhubtest.Fault{Status: http.StatusServiceUnavailable})
+	shaSum, err := conn.UploadFile(ctx, "", dbhub.UploadInformation{}, path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, srv.Calls("/v1/upload"))
+	sum := sha256.Sum256(dbBytes)
+	assert.Equal(t, hex.EncodeToString(sum[:]), shaSum)
+
+	body, err := conn.Download(dbhubtest.DefaultUser, "example.db", dbhub.Identifier{})
+	require.NoError(t, err)
+	downloaded, err := io.ReadAll(body)
+	body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, dbBytes, downloaded)
+
+	shaSum, err = conn.UploadLiveFile(ctx, "live.db", path)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:]), shaSum)
+	dbs, err := conn.DatabasesLive()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"live.db"}, dbs)
+
+	// Readers which can't seek can't be sent again, so the error from the first attempt is returned
+	srv.Script("/v1/upload", dbhubtest.Fault{Status: http.StatusServiceUnavailable})
+	r := struct{ io.Reader }{bytes.NewReader(dbBytes)}
+	_, err = conn.UploadReader(ctx, "once.db", dbhub.UploadInformation{}, r, int64(len(dbBytes)))
+	var apiErr *dbhub.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.Equal(t, 4, srv.Calls("/v1/upload"))
+
+	// But ones which can seek can
+	srv.Script("/v1/upload", dbhubtest.Fault{Status: http.StatusServiceUnavailable})
+	_, err = conn.UploadReader(ctx, "twice.db", dbhub.UploadInformation{}, bytes.NewReader(dbBytes), int64(len(dbBytes)))
+	assert.NoError(t, err)
+
+	// Missing files are reported before anything is sent
+	_, err = conn.UploadFile(ctx, "", dbhub.UploadInformation{}, filepath.Join(t.TempDir(), "missing.db"))
+	assert.Error(t, err)
+}